@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"personal-performance-metrics/metrics"
+)
+
+// backfillDateLayout is the layout of the date in backfill file names and --since.
+const backfillDateLayout = "2006-01-02"
+
+// backfillPattern matches data files named with a date, such as data-2024-01-15.yml
+// or the compressed data-2024-01-15.yml.gz.
+var backfillPattern = regexp.MustCompile(`(\d{4}-\d{2}-\d{2})\.(ya?ml|json|csv)(\.gz)?$`)
+
+// backfillFile is a data file in the backfill directory, the date it was taken and its prepared data.
+type backfillFile struct {
+	path string
+	date time.Time
+	data metrics.PerformanceData
+}
+
+// backfill will publish each dated data file in the directory, using the date in the
+// file name as the timestamp of any metrics without their own.
+func backfill(ctx context.Context, dir string, cfg metrics.Config) (err error) {
+	started := time.Now()
+	var total metrics.PublishSummary
+	defer func() {
+		printSummary(cfg, total, time.Since(started), err)
+	}()
+
+	files, err := findBackfillFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	var pending []backfillFile
+	for _, file := range files {
+		data, err := metrics.LoadData(file.path, dataOptions())
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.path, err)
+		}
+		if *cliPassthrough {
+			if err := metrics.AddPassthroughMappings(&cfg, data); err != nil {
+				return fmt.Errorf("%s: %w", file.path, metrics.ValidationError(err))
+			}
+		}
+		data, err = prepareData(stampData(data, file.date), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.path, err)
+		}
+		if len(data) > 0 {
+			file.data = data
+			pending = append(pending, file)
+		}
+	}
+
+	if len(pending) == 0 {
+		metrics.LogInfo("No metrics to backfill.")
+		return nil
+	}
+
+	publisher, err := newPublisher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closePublisher(publisher)
+
+	for _, file := range pending {
+		metrics.LogInfo(fmt.Sprintf("Backfilling %s for %s.", filepath.Base(file.path), file.date.Format(backfillDateLayout)), "file", file.path, "date", file.date.Format(backfillDateLayout))
+		summary, err := metrics.PublishMetrics(publisher, file.data, nil, cfg, publishOptions())
+		total.Published += summary.Published
+		total.Skipped += summary.Skipped
+		total.Batches += summary.Batches
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.path, err)
+		}
+	}
+	if total.Published == 0 {
+		return nil
+	}
+	return emitMeta(publisher, cfg, total.Published, time.Since(started))
+}
+
+// findBackfillFiles will return the dated data files in the directory, oldest first,
+// skipping those before --since or outside of the CloudWatch backfill limit.
+func findBackfillFiles(dir string) ([]backfillFile, error) {
+	var since time.Time
+	if *cliSince != "" {
+		var err error
+		since, err = time.Parse(backfillDateLayout, *cliSince)
+		if err != nil {
+			return nil, metrics.ConfigError(fmt.Errorf("invalid --since date %q, expected YYYY-MM-DD", *cliSince))
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, metrics.ConfigError(fmt.Errorf("unable to read backfill directory: %w", err))
+	}
+
+	oldest := time.Now().Add(-metrics.MaxMetricAge)
+	var files []backfillFile
+	for _, entry := range entries {
+		match := backfillPattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		date, err := time.Parse(backfillDateLayout, match[1])
+		if err != nil {
+			metrics.LogWarn(fmt.Sprintf("Skipping %s, %q is not a valid date.", entry.Name(), match[1]), "file", entry.Name())
+			continue
+		}
+		if date.Before(since) {
+			continue
+		}
+		if date.Before(oldest) {
+			metrics.LogWarn(fmt.Sprintf("Skipping %s, it is older than the two week limit.", entry.Name()), "file", entry.Name())
+			continue
+		}
+		files = append(files, backfillFile{path: filepath.Join(dir, entry.Name()), date: date})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].date.Before(files[j].date)
+	})
+	return files, nil
+}
+
+// stampData will set the timestamp of each metric without one to the given time.
+func stampData(data metrics.PerformanceData, timestamp time.Time) metrics.PerformanceData {
+	stamped := make(metrics.PerformanceData, len(data))
+	for key, value := range data {
+		if value.Timestamp == nil {
+			value.Timestamp = &timestamp
+		}
+		stamped[key] = value
+	}
+	return stamped
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"personal-performance-metrics/metrics"
+)
+
+// doctor will print how the AWS region, credentials and caller identity are resolved,
+// explaining which step failed when they cannot be, without publishing anything.
+func doctor() error {
+	configInput, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	diagnosis, err := metrics.Diagnose(context.Background(), configInput, *cliTimeout)
+	if resolved := diagnosis.String(); resolved != "" {
+		fmt.Println(resolved)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("AWS configuration resolved successfully.")
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+
+	"personal-performance-metrics/metrics"
+)
+
+// explain will print how each data key maps to a datum, and whether it would be published or
+// why it is skipped, without publishing anything.
+func explain(configInput metrics.Config) error {
+	dataInput, err := loadData()
+	if err != nil {
+		return err
+	}
+
+	if *cliPassthrough {
+		if err := metrics.AddPassthroughMappings(&configInput, dataInput); err != nil {
+			return metrics.ValidationError(err)
+		}
+	}
+
+	// The checks are explained per key, rather than failing the whole explanation.
+	prepared, err := transformData(dataInput, configInput)
+	if err != nil {
+		return err
+	}
+	return metrics.ExplainData(os.Stdout, dataInput, prepared, configInput, metrics.ExplainOptions{Selected: *cliMetrics, Redact: *cliRedact})
+}
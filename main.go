@@ -1,74 +1,259 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	"github.com/pterm/pterm"
-	"gopkg.in/yaml.v3"
+	"golang.org/x/term"
+	"personal-performance-metrics/metrics"
 )
 
-// Config provides global configuration
-type Config struct {
-	Region          string                   `yaml:"region"`
-	Profile         string                   `yaml:"profile"`
-	SkipPublish     bool                     `yaml:"skipPublish"`
-	MetricNamespace string                   `yaml:"metricNamespace"`
-	MetricMappings  map[string]MetricMapping `yaml:"metricMappings"`
-}
+const (
+	defaultConfigFile = "config.yml"
+	defaultDataFile   = "data.yml"
 
-// MetricMapping is the configuration data for the metrics.
-type MetricMapping struct {
-	Name       string                    `yaml:"name"`
-	Dimensions []MetricMappingDimensions `yaml:"dimensions"`
-}
+	logFormatText = "text"
+	logFormatJSON = "json"
 
-// MetricMappingDimensions is the definition for the dimensions associated to the metric.
-type MetricMappingDimensions struct {
-	Name  string `yaml:"name"`
-	Value string `yaml:"value"`
-}
+	backendCloudWatch  = "cloudwatch"
+	backendPushgateway = "pushgateway"
+	backendOTLP        = "otlp"
+	backendFile        = "file"
+	backendEMF         = "emf"
+	backendDatadog     = "datadog"
 
-// PerformanceData is the data being captured and sent to AWS.
-type PerformanceData map[string]float64
+	summaryFormatJSON = "json"
+
+	configSourceFile = "file"
+	configSourceSSM  = "ssm"
+)
 
 var (
-	cliRegion         = kingpin.Flag("region", "AWS Region to push metrics").Envar("AWS_REGION").String()
-	cliProfile        = kingpin.Flag("profile", "Configured AWS profile to use").Envar("AWS_PROFILE").String()
-	cliSkipPublish    = kingpin.Flag("skip-publish", "Skip publishing metrics").Default("false").Bool()
-	cliNoninteractive = kingpin.Flag("non-interactive", "Perform work without interactions").Default("false").Bool()
+	cliConfigFiles          = kingpin.Flag("config", "Path to a configuration file, repeatable with later files merged over earlier ones").Envar("CONFIG_FILE").Default(defaultConfigFile).Strings()
+	cliConfigSource         = kingpin.Flag("config-source", "Where to load the configuration from").Default(configSourceFile).Enum(configSourceFile, configSourceSSM)
+	cliSSMPath              = kingpin.Flag("ssm-path", "Name of the SSM parameter holding the configuration, for --config-source ssm").Envar("SSM_CONFIG_PATH").String()
+	cliEnv                  = kingpin.Flag("env", "Environment to use from the environments of the config, merging its overlay such as config.prod.yml when it exists").Envar("METRICS_ENV").String()
+	cliFile                 = kingpin.Flag("file", "Path to a combined file holding both the config and data sections, in place of --config and --data").Envar("METRICS_FILE").String()
+	cliDataFiles            = kingpin.Flag("data", "Path to a data file, an HTTP or HTTPS URL to fetch it from, or - to read from stdin, repeatable").Envar("DATA_FILE").Default(defaultDataFile).Strings()
+	cliDataFormat           = kingpin.Flag("data-format", "Decode the data files in this format instead of detecting it").Enum(metrics.DataFormatYAML, metrics.DataFormatJSON, metrics.DataFormatCSV)
+	cliKeySeparator         = kingpin.Flag("key-separator", "Separator joining the keys of nested data into a single data key").Default(".").String()
+	cliMergeStrategy        = kingpin.Flag("merge-strategy", "How to handle a key found in more than one data file, or a metric mapping in more than one config file").Default(metrics.MergeError).Enum(metrics.MergeError, metrics.MergeLastWins)
+	cliRegion               = kingpin.Flag("region", "AWS Region to push metrics").Envar("AWS_REGION").String()
+	cliAdditionalRegions    = kingpin.Flag("additional-region", "Additional AWS Region to push metrics, may be repeated").Strings()
+	cliNamespace            = kingpin.Flag("namespace", "CloudWatch namespace, overriding the config file").Envar("METRIC_NAMESPACE").String()
+	cliProfile              = kingpin.Flag("profile", "Configured AWS profile to use, or a comma-separated list to publish to each of them").Envar("AWS_PROFILE").String()
+	cliAccessKeyID          = kingpin.Flag("access-key-id", "Static AWS access key ID to use instead of a profile").Envar("AWS_ACCESS_KEY_ID").String()
+	cliSecretAccessKey      = kingpin.Flag("secret-access-key", "Static AWS secret access key to use instead of a profile").Envar("AWS_SECRET_ACCESS_KEY").String()
+	cliSessionToken         = kingpin.Flag("session-token", "Static AWS session token to use with the access key").Envar("AWS_SESSION_TOKEN").String()
+	cliRoleARN              = kingpin.Flag("role-arn", "IAM role to assume before publishing metrics").Envar("AWS_ROLE_ARN").String()
+	cliExternalID           = kingpin.Flag("external-id", "External ID to use when assuming the role").String()
+	cliRoleSession          = kingpin.Flag("role-session-name", "Session name to use when assuming the role").String()
+	cliExpectedAccountID    = kingpin.Flag("expected-account-id", "Abort unless the credentials are for this AWS account").Envar("EXPECTED_ACCOUNT_ID").String()
+	cliEndpointURL          = kingpin.Flag("endpoint-url", "Custom AWS endpoint to send requests to, such as LocalStack").Envar("AWS_ENDPOINT_URL").String()
+	cliInsecure             = kingpin.Flag("insecure", "Skip verifying the TLS certificate of the AWS endpoint").Bool()
+	cliSkipPublish          = kingpin.Flag("skip-publish", "Skip publishing metrics").Default("false").Bool()
+	cliYes                  = kingpin.Flag("yes", "Default the confirmation prompt to yes when no answer is given").Bool()
+	cliNoninteractive       = kingpin.Flag("non-interactive", "Perform work without interactions").Default("false").Bool()
+	cliOutput               = kingpin.Flag("output", "Output format for the metrics preview").Default(metrics.OutputTable).Enum(metrics.OutputTable, metrics.OutputJSON, metrics.OutputAWSCLI, metrics.OutputMarkdown)
+	cliMaxRetries           = kingpin.Flag("max-retries", "Maximum number of retries for throttled or failed requests").Default("3").Int()
+	cliMetrics              = kingpin.Flag("metric", "Only publish the given data key, may be repeated").Strings()
+	cliLogFormat            = kingpin.Flag("log-format", "Format of status messages").Default(logFormatText).Enum(logFormatText, logFormatJSON)
+	cliTimeout              = kingpin.Flag("timeout", "Timeout for each AWS operation").Default("30s").Duration()
+	cliConcurrency          = kingpin.Flag("concurrency", "Number of PutMetricData requests to send at once").Default("4").Int()
+	cliFailFast             = kingpin.Flag("fail-fast", "Stop sending requests after the first failure").Bool()
+	cliBatchSize            = kingpin.Flag("batch-size", "Maximum number of datums in each PutMetricData request, from 1 to 1000").Default("1000").Int()
+	cliBisectOnFailure      = kingpin.Flag("bisect-on-failure", "Split a batch rejected as invalid to find and report the rejected datums, publishing the rest").Bool()
+	cliBatchDelay           = kingpin.Flag("batch-delay", "Time to wait before sending each PutMetricData request after the first").Default("0s").Duration()
+	cliAuditFile            = kingpin.Flag("audit-file", "Append a JSON record of each publish attempt to this file").String()
+	cliBackend              = kingpin.Flag("backend", "Backend to publish metrics to").Default(backendCloudWatch).Enum(backendCloudWatch, backendPushgateway, backendOTLP, backendFile, backendEMF, backendDatadog)
+	cliPushgatewayURL       = kingpin.Flag("pushgateway-url", "URL of the Prometheus Pushgateway").Envar("PUSHGATEWAY_URL").String()
+	cliPushgatewayJob       = kingpin.Flag("pushgateway-job", "Job name to group the metrics under in the Pushgateway").Default("personal-performance-metrics").String()
+	cliOTLPEndpoint         = kingpin.Flag("otlp-endpoint", "OTLP collector endpoint, using the grpc, grpcs, http or https scheme").Envar("OTEL_EXPORTER_OTLP_ENDPOINT").String()
+	cliDatadogAPIKey        = kingpin.Flag("datadog-api-key", "API key to submit metrics to Datadog with").Envar("DD_API_KEY").String()
+	cliDatadogSite          = kingpin.Flag("datadog-site", "Datadog site to submit metrics to, such as datadoghq.eu, or the URL of its API").Envar("DD_SITE").Default("datadoghq.com").String()
+	cliOut                  = kingpin.Flag("out", "File to write the metrics to as JSON lines, for the file backend, or the EMF events to instead of stdout, for the emf backend").String()
+	cliSortDimensions       = kingpin.Flag("sort-dimensions", "Sort the dimensions of every metric by name, which changes the identity of metrics in CloudWatch").Bool()
+	cliAddRuntimeDimension  = kingpin.Flag("add-runtime-dimension", "Add a dimension holding the start time of the run to every metric").Bool()
+	cliRuntimeDimensionName = kingpin.Flag("runtime-dimension-name", "Name of the dimension added by --add-runtime-dimension").Default("RunTime").String()
+	cliNoColor              = kingpin.Flag("no-color", "Disable colours and render plain ASCII tables").Bool()
+	cliRedact               = kingpin.Flag("redact", "Mask every dimension value in the preview table, still publishing the real values").Bool()
+	cliQuiet                = kingpin.Flag("quiet", "Only print errors, skipping the table and status messages").Bool()
+	cliVerbose              = kingpin.Flag("verbose", "Log the resolved config and each request sent to CloudWatch with its request ID").Bool()
+	cliEmptyExitCode        = kingpin.Flag("empty-exit-code", "Exit code to use when there are no metrics to publish").Default("0").Int()
+	cliClamp                = kingpin.Flag("clamp", "Clamp percent metrics into 0-100 instead of rejecting them").Bool()
+	cliExplain              = kingpin.Flag("explain", "Print how each data key maps to a metric and whether it would be published, without publishing").Bool()
+	cliWatch                = kingpin.Flag("watch", "Republish whenever a data file changes, without prompting").Bool()
+	cliMinInterval          = kingpin.Flag("min-interval", "Refuse to publish again within this long of the last publish, such as 5m").Default("0s").Duration()
+	cliForce                = kingpin.Flag("force", "Publish even within the --min-interval of the last publish").Bool()
+	cliStateFile            = kingpin.Flag("state-file", "File recording the time of the last publish for --min-interval, in the user cache directory by default").String()
+	cliBackfill             = kingpin.Flag("backfill", "Directory of dated data files, such as data-2024-01-15.yml, to publish with the date of each file").String()
+	cliSince                = kingpin.Flag("since", "Only backfill files dated on or after this date (YYYY-MM-DD)").String()
+	cliTimestampOffset      = kingpin.Flag("timestamp-offset", "Shift the timestamp of metrics without their own by this much, such as -5m").Default("0s").Duration()
+	cliCompare              = kingpin.Flag("compare", "Data file of previously published values to show the change from").String()
+	cliRetryFile            = kingpin.Flag("retry-file", "File to save the metrics which failed to publish to, for retrying with --data").String()
+	cliSaveSnapshot         = kingpin.Flag("save-snapshot", "File to save the published data to, after scaling, for a later --compare").String()
+	cliEmitMeta             = kingpin.Flag("emit-meta", "After publishing, also publish the number of metrics published and how long it took").Bool()
+	cliMetaNamespace        = kingpin.Flag("meta-namespace", "Namespace for the metrics published by --emit-meta").Default("PersonalPerformanceMetrics").String()
+	cliInferUnits           = kingpin.Flag("infer-units", "Infer the unit of metrics without one from a name suffix such as _ms or _bytes").Bool()
+	cliUnit                 = kingpin.Flag("unit", "Unit to publish every metric with, in place of the units in the config").String()
+	cliPassthrough          = kingpin.Flag("passthrough", "Publish data keys without a metric mapping under their key, with only the default dimensions").Bool()
+	cliAllowDuplicates      = kingpin.Flag("allow-duplicates", "Publish every data key even when several map to the same metric, dimensions and timestamp").Bool()
+	cliPreviewLive          = kingpin.Flag("preview-live", "Show the current CloudWatch average of each metric in the preview").Bool()
+	cliPreviewWindow        = kingpin.Flag("preview-window", "How far back --preview-live averages the current values").Default("1h").Duration()
+	cliRequireDimensions    = kingpin.Flag("require-dimensions", "Abort when a metric has no dimensions once the config is resolved").Bool()
+	cliSummary              = kingpin.Flag("summary", "Print a final summary of the run in this format, even when it fails").Enum(summaryFormatJSON)
+	cliStrict               = kingpin.Flag("strict", "Abort instead of warning about unmapped data keys, NaN or infinite values, unknown config keys or an outdated config version").Default("false").Bool()
+
+	publishCommand  = kingpin.Command("publish", "Publish metrics to the selected backend").Default()
+	validateCommand = kingpin.Command("validate", "Validate the configuration and data files without publishing")
+	doctorCommand   = kingpin.Command("doctor", "Show how the AWS region, credentials and account are resolved, without publishing")
+	scaffoldCommand = kingpin.Command("scaffold", "Generate metric mapping stubs for data keys without one")
+	scaffoldWrite   = scaffoldCommand.Flag("write", "Merge the stubs into the configuration file instead of printing them").Default("false").Bool()
 )
 
 // run will execute the main logic component for error handling.
 func run() error {
+	started := time.Now().UTC()
+	ctx := interruptContext()
 
-	configInput, err := loadConfig()
+	configInput, err := loadRunConfig(started)
 	if err != nil {
+		// Nothing was published, but automation still gets a summary with the error.
+		printSummary(configInput, metrics.PublishSummary{}, time.Since(started), err)
 		return err
 	}
 
+	// Stdin is consumed by the data, so it cannot be used to answer the prompt.
+	if slices.ContainsFunc(*cliDataFiles, metrics.IsStdin) {
+		*cliNoninteractive = true
+	}
+
+	if *cliExplain {
+		return explain(configInput)
+	}
+
+	if *cliBackfill != "" {
+		return backfill(ctx, *cliBackfill, configInput)
+	}
+
+	if *cliWatch {
+		return watch(ctx, configInput)
+	}
+
+	return publishDataFiles(ctx, configInput)
+}
+
+// loadRunConfig will load the configuration, adding the runtime dimension when it is requested.
+func loadRunConfig(started time.Time) (metrics.Config, error) {
+	configInput, err := loadConfig()
+	if err != nil {
+		return configInput, err
+	}
+
+	// Every metric shares the one run timestamp, so the datums can be grouped by run.
+	if *cliAddRuntimeDimension {
+		dimension := metrics.MetricMappingDimensions{Name: *cliRuntimeDimensionName, Value: started.Format(time.RFC3339)}
+		prefixed := dimension
+		prefixed.Name = configInput.DimensionNamePrefix + dimension.Name
+		if err := metrics.ValidateDimension("--runtime-dimension-name", prefixed); err != nil {
+			return configInput, metrics.ConfigError(err)
+		}
+		configInput.DefaultDimensions = append(configInput.DefaultDimensions, dimension)
+	}
+	return configInput, nil
+}
+
+// loadConfig will load the configuration file, falling back to the flags for
+// anything it does not set.
+func loadConfig() (metrics.Config, error) {
+	configInput, err := readConfig()
+	if err != nil {
+		return configInput, err
+	}
+
 	if configInput.Region == "" {
 		configInput.Region = *cliRegion
-		if configInput.Region == "" {
-			return fmt.Errorf("AWS_REGION environment variable not set")
+	}
+
+	if len(configInput.AdditionalRegions) == 0 {
+		configInput.AdditionalRegions = *cliAdditionalRegions
+	}
+
+	if *cliNamespace != "" {
+		if err := metrics.ValidateNamespace("--namespace", *cliNamespace); err != nil {
+			return configInput, metrics.ValidationError(err)
 		}
+		configInput.MetricNamespace = *cliNamespace
+	}
+
+	if configInput.AccessKeyID == "" && configInput.SecretAccessKey == "" {
+		configInput.AccessKeyID = *cliAccessKeyID
+		configInput.SecretAccessKey = *cliSecretAccessKey
+		configInput.SessionToken = *cliSessionToken
 	}
 
 	if configInput.Profile == "" {
 		configInput.Profile = *cliProfile
-		if configInput.Profile == "" {
-			return fmt.Errorf("AWS_PROFILE environment variable not set")
+	}
+	if len(configInput.Profiles) == 0 && strings.Contains(configInput.Profile, ",") {
+		for _, profile := range strings.Split(configInput.Profile, ",") {
+			configInput.Profiles = append(configInput.Profiles, strings.TrimSpace(profile))
+		}
+		configInput.Profile = configInput.Profiles[0]
+	}
+
+	if configInput.MetaNamespace == "" {
+		if err := metrics.ValidateNamespace("--meta-namespace", *cliMetaNamespace); err != nil {
+			return configInput, metrics.ValidationError(err)
+		}
+		configInput.MetaNamespace = *cliMetaNamespace
+	}
+
+	if configInput.RoleARN == "" {
+		configInput.RoleARN = *cliRoleARN
+	}
+
+	if configInput.ExternalID == "" {
+		configInput.ExternalID = *cliExternalID
+	}
+
+	if configInput.ExpectedAccountID == "" {
+		configInput.ExpectedAccountID = *cliExpectedAccountID
+	}
+
+	if configInput.RoleSessionName == "" {
+		configInput.RoleSessionName = *cliRoleSession
+	}
+
+	if configInput.EndpointURL == "" {
+		configInput.EndpointURL = *cliEndpointURL
+	}
+
+	if *cliInsecure {
+		configInput.Insecure = true
+	}
+
+	if *cliSortDimensions {
+		configInput.SortDimensions = true
+	}
+
+	if *cliInferUnits {
+		metrics.InferUnits(&configInput)
+	}
+
+	if *cliUnit != "" {
+		if err := metrics.OverrideUnits(&configInput, *cliUnit); err != nil {
+			return configInput, metrics.ValidationError(fmt.Errorf("--unit: %w", err))
 		}
 	}
 
@@ -76,171 +261,348 @@ func run() error {
 		configInput.SkipPublish = true
 	}
 
+	if *cliYes {
+		configInput.ConfirmDefault = true
+	}
+
+	return configInput, nil
+}
+
+// readConfig will load the configuration from the selected source. Configuration in SSM
+// is fetched with the region and credentials given by the flags.
+func readConfig() (metrics.Config, error) {
+	opts := metrics.ConfigOptions{Env: *cliEnv, Strict: *cliStrict, RequireDimensions: *cliRequireDimensions}
+	if *cliFile != "" {
+		if *cliConfigSource == configSourceSSM {
+			return metrics.Config{}, metrics.ConfigError(errors.New("--file cannot be used with the ssm config source"))
+		}
+		return metrics.LoadCombinedConfig(*cliFile, opts)
+	}
+	if *cliConfigSource != configSourceSSM {
+		return metrics.LoadConfigFiles(*cliConfigFiles, *cliMergeStrategy, opts)
+	}
+
+	credentials := metrics.Config{
+		Region:          *cliRegion,
+		Profile:         strings.TrimSpace(strings.Split(*cliProfile, ",")[0]),
+		AccessKeyID:     *cliAccessKeyID,
+		SecretAccessKey: *cliSecretAccessKey,
+		SessionToken:    *cliSessionToken,
+		RoleARN:         *cliRoleARN,
+		ExternalID:      *cliExternalID,
+		RoleSessionName: *cliRoleSession,
+		EndpointURL:     *cliEndpointURL,
+		Insecure:        *cliInsecure,
+	}
+	return metrics.LoadConfigFromSSM(context.Background(), *cliSSMPath, credentials, opts, *cliTimeout)
+}
+
+// interruptContext will return a context cancelled by the first SIGINT or SIGTERM, so an
+// interrupted publish can stop sending and report how far it got. Any further interrupt
+// quits straight away, such as when waiting at the confirmation prompt.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		metrics.LogWarn("Interrupted, stopping once the requests in flight finish. Interrupt again to quit immediately.")
+		cancel()
+	}()
+	return ctx
+}
+
+// publishDataFiles will load the data files and publish them with the selected backend.
+func publishDataFiles(ctx context.Context, configInput metrics.Config) (err error) {
+	started := time.Now()
+	var summary metrics.PublishSummary
+	defer func() {
+		printSummary(configInput, summary, time.Since(started), err)
+	}()
+
 	dataInput, err := loadData()
 	if err != nil {
 		return err
 	}
+	loaded := dataInput
 
-	// Prepare AWS configuration options
-	var opts []func(*config.LoadOptions) error
+	if *cliPassthrough {
+		if err := metrics.AddPassthroughMappings(&configInput, dataInput); err != nil {
+			return metrics.ValidationError(err)
+		}
+	}
 
-	// Add profile option if provided
-	if configInput.Profile != "" {
-		opts = append(opts, config.WithSharedConfigProfile(configInput.Profile))
+	dataInput, err = prepareData(dataInput, configInput)
+	if err != nil {
+		return err
 	}
 
-	// Add region option if provided
-	if configInput.Region != "" {
-		opts = append(opts, config.WithRegion(configInput.Region))
+	if len(dataInput) == 0 {
+		if *cliEmptyExitCode != 0 {
+			return metrics.Categorise(errors.New("no metrics to publish"), *cliEmptyExitCode)
+		}
+		metrics.LogInfo("No metrics to publish.")
+		return nil
+	}
+
+	// A dry run neither publishes nor counts as the last publish.
+	guarded := *cliMinInterval > 0 && !configInput.SkipPublish
+	var statePath string
+	if guarded {
+		if statePath, err = stateFile(); err != nil {
+			return err
+		}
+		if !*cliForce {
+			if err := metrics.CheckMinInterval(statePath, *cliMinInterval, time.Now()); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	publisher, err := newPublisher(ctx, configInput)
 	if err != nil {
-		fmt.Println("Error creating AWS config:", err)
 		return err
 	}
-
-	// Create CloudWatch client
-	client := cloudwatch.NewFromConfig(cfg)
+	defer closePublisher(publisher)
 
 	// Publish metrics
-	err = publishMetrics(client, dataInput, configInput)
+	var previous metrics.PerformanceData
+	switch {
+	case *cliCompare != "" && *cliPreviewLive:
+		return metrics.ConfigError(errors.New("--compare and --preview-live cannot be used together"))
+	case *cliCompare != "":
+		previous, err = metrics.ReadData(*cliCompare, metrics.DataOptions{KeySeparator: *cliKeySeparator, Timeout: *cliTimeout})
+		if err != nil {
+			return err
+		}
+		// Snapshots are saved after scaling, so only data files are scaled.
+		if !metrics.IsSnapshot(*cliCompare) {
+			previous = metrics.ScaleData(previous, configInput)
+		}
+	case *cliPreviewLive:
+		previous, err = metrics.CurrentValues(publisher, dataInput, configInput, *cliPreviewWindow)
+		if err != nil {
+			return err
+		}
+	}
+
+	summary, err = metrics.PublishMetrics(publisher, dataInput, previous, configInput, publishOptions())
+	if failed := metrics.FailedKeys(err); *cliRetryFile != "" && len(failed) > 0 {
+		// The data is saved as it was loaded, so the retry is scaled and derived the same way.
+		if saveErr := metrics.SaveRetryFile(*cliRetryFile, loaded, dataInput, failed, configInput, started); saveErr != nil {
+			return errors.Join(err, saveErr)
+		}
+	}
 	if err != nil {
 		return err
 	}
-
-	return nil
+	// A dry run is saved too, but not a publish cancelled at the prompt.
+	if *cliSaveSnapshot != "" && (summary.Sent || configInput.SkipPublish) {
+		if err := metrics.SaveSnapshot(*cliSaveSnapshot, dataInput, started); err != nil {
+			return err
+		}
+	}
+	if !summary.Sent {
+		return nil
+	}
+	if guarded {
+		if err := metrics.RecordPublish(statePath, started); err != nil {
+			return err
+		}
+	}
+	return emitMeta(publisher, configInput, summary.Published, time.Since(started))
 }
 
-// loadConfig will load the configuration file.
-func loadConfig() (Config, error) {
-	var cfg Config
-	file, err := os.ReadFile("config.yml")
-	if err != nil {
-		return cfg, err
+// stateFile will return the path of the state file recording the last publish.
+func stateFile() (string, error) {
+	if *cliStateFile != "" {
+		return *cliStateFile, nil
 	}
-	err = yaml.Unmarshal(file, &cfg)
-	return cfg, err
+	return metrics.DefaultStateFile()
 }
 
-// lodaData will load the data file.
-func loadData() (PerformanceData, error) {
-	var data PerformanceData
-	file, err := os.ReadFile("data.yml")
-	if err != nil {
-		return data, err
+// emitMeta will publish how many metrics were published and how long it took, when
+// --emit-meta is set, so the pipeline itself can be alerted on.
+func emitMeta(publisher metrics.Publisher, configInput metrics.Config, published int, duration time.Duration) error {
+	if !*cliEmitMeta {
+		return nil
+	}
+	data, metaConfig := metrics.MetaMetrics(configInput.MetaNamespace, published, duration)
+	if err := publisher.Publish(data, metaConfig); err != nil {
+		return metrics.PublishError(fmt.Errorf("unable to publish meta-metrics: %w", err))
 	}
-	err = yaml.Unmarshal(file, &data)
-	return data, err
+	return nil
 }
 
-// printTable will print a table showing all the metrics which are going to be pushed.
-func printTable(data PerformanceData, config Config) error {
-	alternateStyle := pterm.NewStyle(pterm.BgDarkGray)
-	tableData := pterm.TableData{
-		{"Metric name", "Value", "Dimensions"},
+// prepareData will transform the data and check it for values CloudWatch would reject.
+func prepareData(data metrics.PerformanceData, config metrics.Config) (metrics.PerformanceData, error) {
+	data, err := transformData(data, config)
+	if err != nil {
+		return data, err
 	}
-	fmt.Sprint(alternateStyle, tableData)
 
-	for key, val := range data {
-		var dimensions string
-		for _, v := range config.MetricMappings[key].Dimensions {
-			dimensions += fmt.Sprintf("%s=%s ", v.Name, v.Value)
-		}
-		tableData = append(tableData, []string{config.MetricMappings[key].Name, fmt.Sprint(math.Round(val*100) / 100), dimensions})
+	if err := errors.Join(metrics.CheckMetrics(data, config)...); err != nil {
+		return data, metrics.ValidationError(err)
 	}
-
-	fmt.Println("Metrics to be published:")
-	return pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData).WithStyle(alternateStyle).Render()
+	return data, nil
 }
 
-// publishMetrics will publish the metrics to the nominated AWS account.
-func publishMetrics(client *cloudwatch.Client, data PerformanceData, config Config) error {
-	err := printTable(data, config)
+// transformData will derive, filter, scale, shift, clamp and deduplicate the data as set by
+// the config and flags, without checking the result can be published.
+func transformData(data metrics.PerformanceData, config metrics.Config) (metrics.PerformanceData, error) {
+	data, err := metrics.DeriveMetrics(data, config)
 	if err != nil {
-		return err
+		return data, metrics.ValidationError(err)
 	}
 
-	// Do not publish until we're ready.
-	if config.SkipPublish {
-		fmt.Println("You have elected to not publish these metrics, exiting...")
-		return nil
+	if len(*cliMetrics) > 0 {
+		data = metrics.FilterData(data, *cliMetrics)
 	}
 
-	var metricData []types.MetricDatum
+	data = metrics.ScaleData(data, config)
 
-	for key, value := range data {
-		metric, ok := config.MetricMappings[key]
-		if !ok {
-			continue
+	// Shifting the time of datums without their own lets alarms be tested against past data.
+	if *cliTimestampOffset != 0 {
+		if *cliTimestampOffset < -metrics.MaxMetricAge || *cliTimestampOffset > metrics.MaxMetricLead {
+			return data, metrics.ConfigError(fmt.Errorf("--timestamp-offset %s is outside of the CloudWatch window of %s in the past to %s in the future", *cliTimestampOffset, metrics.MaxMetricAge, metrics.MaxMetricLead))
 		}
+		data = stampData(data, time.Now().Add(*cliTimestampOffset))
+	}
 
-		metricValue := math.Round(value*100) / 100
-		metricDatum := types.MetricDatum{
-			MetricName: aws.String(metric.Name),
-			Value:      aws.Float64(metricValue),
-			Timestamp:  aws.Time(time.Now()),
-			Unit:       types.StandardUnitCount,
-		}
+	if *cliClamp {
+		data = metrics.ClampPercentages(data, config)
+	}
 
-		for _, dimension := range metric.Dimensions {
-			metricDatum.Dimensions = append(metricDatum.Dimensions, types.Dimension{
-				Name:  &dimension.Name,
-				Value: &dimension.Value,
-			})
-		}
+	if !*cliAllowDuplicates {
+		data = metrics.DedupeData(data, config)
+	}
+	return data, nil
+}
 
-		metricData = append(metricData, metricDatum)
+// newPublisher will create the publisher for the selected backend.
+func newPublisher(ctx context.Context, cfg metrics.Config) (metrics.Publisher, error) {
+	switch *cliBackend {
+	case backendPushgateway:
+		return metrics.NewPushgatewayPublisher(ctx, *cliPushgatewayURL, *cliPushgatewayJob, *cliTimeout)
+	case backendOTLP:
+		return metrics.NewOTLPPublisher(ctx, *cliOTLPEndpoint, *cliTimeout)
+	case backendFile:
+		return metrics.NewFilePublisher(*cliOut)
+	case backendEMF:
+		return metrics.NewEMFPublisher(*cliOut), nil
+	case backendDatadog:
+		return metrics.NewDatadogPublisher(ctx, *cliDatadogAPIKey, *cliDatadogSite, *cliTimeout)
+	}
+	// Zero would mean the default to the library, so it is rejected here.
+	if *cliBatchSize < 1 {
+		return nil, metrics.ConfigError(fmt.Errorf("--batch-size %d is out of range, it must be between 1 and 1000", *cliBatchSize))
 	}
+	return metrics.NewCloudWatchPublisher(ctx, cfg, metrics.CloudWatchOptions{
+		Timeout:     *cliTimeout,
+		MaxRetries:  *cliMaxRetries,
+		Concurrency: *cliConcurrency,
+		FailFast:    *cliFailFast,
+		BatchDelay:  *cliBatchDelay,
+		BatchSize:   *cliBatchSize,
+		AuditFile:   *cliAuditFile,
+		// The bar redraws in place, so it is only shown with plain text status messages.
+		Progress: term.IsTerminal(int(os.Stdout.Fd())) && !*cliQuiet && *cliLogFormat != logFormatJSON,
+		Verbose:  *cliVerbose,
+
+		BisectOnFailure: *cliBisectOnFailure,
+	})
+}
 
-	input := &cloudwatch.PutMetricDataInput{
-		Namespace:  aws.String(config.MetricNamespace),
-		MetricData: metricData,
+// closePublisher will shut down the connection of the publisher, warning when it cannot be.
+func closePublisher(publisher metrics.Publisher) {
+	if err := metrics.ClosePublisher(publisher); err != nil {
+		metrics.LogWarn(err.Error(), "error", err)
 	}
+}
 
-	if *cliNoninteractive || confirm("Do you want to proceed?") {
-		_, err = client.PutMetricData(context.TODO(), input)
-		if err != nil {
-			return err
-		}
-		fmt.Println("Metrics published successfully!")
-	} else {
-		fmt.Println("Operation cancelled.")
+// loadData will load the data from the data files, or from the data section of the combined
+// file when one is given.
+func loadData() (metrics.PerformanceData, error) {
+	if *cliFile != "" {
+		return metrics.LoadCombinedData(*cliFile, dataOptions())
 	}
+	return metrics.LoadDataFiles(*cliDataFiles, *cliMergeStrategy, dataOptions())
+}
 
-	return nil
+// dataOptions will return how the data files are decoded, from the flags.
+func dataOptions() metrics.DataOptions {
+	return metrics.DataOptions{Format: *cliDataFormat, KeySeparator: *cliKeySeparator, Timeout: *cliTimeout}
 }
 
-// confirm will accept input for a prompt.
-func confirm(prompt string) bool {
-	reader := bufio.NewReader(os.Stdin)
+// publishOptions will return how metrics are previewed and confirmed, from the flags.
+func publishOptions() metrics.PublishOptions {
+	return metrics.PublishOptions{
+		Output:         *cliOutput,
+		Plain:          plainOutput,
+		Redact:         *cliRedact,
+		Quiet:          *cliQuiet,
+		Strict:         *cliStrict,
+		NonInteractive: *cliNoninteractive,
+		Verbose:        *cliVerbose,
+	}
+}
 
-	for {
-		fmt.Printf("%s [y/n]: ", prompt)
+// plainOutput reports whether output should be rendered without styling.
+var plainOutput bool
 
-		response, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println("Error reading input:", err)
-			return false
-		}
+// setupStyling will turn off colours and box drawing when requested, or when
+// stdout is not a terminal.
+func setupStyling() {
+	if *cliNoColor || !term.IsTerminal(int(os.Stdout.Fd())) {
+		plainOutput = true
+		pterm.DisableStyling()
+	}
+}
 
-		response = strings.ToLower(strings.TrimSpace(response))
+// setupLogging will configure logging from the flags, keeping stdout clean for
+// machine-readable output modes.
+func setupLogging() {
+	opts := metrics.LogOptions{
+		Writer:  os.Stdout,
+		JSON:    *cliLogFormat == logFormatJSON,
+		Quiet:   *cliQuiet,
+		Verbose: *cliVerbose,
+	}
+	// EMF events written to stdout are kept apart from the status messages.
+	if *cliOutput != metrics.OutputTable || (*cliBackend == backendEMF && *cliOut == "") {
+		opts.Writer = os.Stderr
+	}
+	metrics.SetupLogging(opts)
+}
 
-		switch response {
-		case "y", "yes":
-			return true
-		case "n", "no":
-			return false
-		default:
-			fmt.Println("Invalid input. Please enter 'y' or 'n'.")
-		}
+// logFatal will report the error which ended the run.
+func logFatal(err error) {
+	if *cliLogFormat == logFormatJSON {
+		metrics.LogError(err.Error(), "exitCode", metrics.ExitCode(err))
+		return
 	}
+	log.Print(err)
 }
 
 func main() {
-	kingpin.Parse()
-	if err := run(); err != nil {
-		log.Fatal(err)
+	command := kingpin.Parse()
+	setupStyling()
+	setupLogging()
+
+	var err error
+	switch command {
+	case validateCommand.FullCommand():
+		err = validate()
+	case doctorCommand.FullCommand():
+		err = doctor()
+	case scaffoldCommand.FullCommand():
+		err = scaffold()
+	case publishCommand.FullCommand():
+		err = run()
+	}
+	if err != nil {
+		logFatal(err)
+		os.Exit(metrics.ExitCode(err))
 	}
 }
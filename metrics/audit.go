@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// auditRecord is a single line in the audit file describing a publish attempt.
+type auditRecord struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Region    string        `json:"region"`
+	Namespace string        `json:"namespace"`
+	Metrics   []auditMetric `json:"metrics"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// auditMetric is a datum which was sent as part of a publish attempt.
+type auditMetric struct {
+	Name       string              `json:"name"`
+	Value      *float64            `json:"value,omitempty"`
+	Statistics *types.StatisticSet `json:"statistics,omitempty"`
+	Unit       types.StandardUnit  `json:"unit"`
+	Timestamp  *time.Time          `json:"timestamp,omitempty"`
+	Dimensions []auditDimension    `json:"dimensions,omitempty"`
+}
+
+// auditDimension is a dimension of an audited datum.
+type auditDimension struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// auditMu serialises writes to the audit file from concurrent publishes.
+var auditMu sync.Mutex
+
+// writeAuditRecord will append a record of the request and its outcome to the audit file.
+func writeAuditRecord(path string, region string, input *cloudwatch.PutMetricDataInput, publishErr error) error {
+	record := auditRecord{
+		Timestamp: time.Now().UTC(),
+		Region:    region,
+		Namespace: *input.Namespace,
+	}
+	if publishErr != nil {
+		record.Error = publishErr.Error()
+	}
+
+	for _, datum := range input.MetricData {
+		metric := auditMetric{
+			Name:       *datum.MetricName,
+			Value:      datum.Value,
+			Statistics: datum.StatisticValues,
+			Unit:       datum.Unit,
+			Timestamp:  datum.Timestamp,
+		}
+		for _, dimension := range datum.Dimensions {
+			metric.Dimensions = append(metric.Dimensions, auditDimension{Name: *dimension.Name, Value: *dimension.Value})
+		}
+		record.Metrics = append(record.Metrics, metric)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,873 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/pterm/pterm"
+)
+
+// cloudWatchPublisher publishes metrics to AWS CloudWatch in one or more regions, with one
+// or more profiles.
+type cloudWatchPublisher struct {
+	ctx     context.Context
+	clients []regionClient
+
+	// now is the timestamp for datums without their own, shared by the preview and the publish.
+	now time.Time
+
+	opts CloudWatchOptions
+}
+
+// CloudWatchOptions controls how requests are sent to CloudWatch.
+type CloudWatchOptions struct {
+	// Timeout bounds each request to AWS.
+	Timeout time.Duration
+
+	// MaxRetries is how many times a throttled or failed request is retried.
+	MaxRetries int
+
+	// Concurrency is how many batches are sent at once.
+	Concurrency int
+
+	// FailFast stops sending batches after the first failure.
+	FailFast bool
+
+	// BatchDelay is how long to wait before starting each batch after the first.
+	BatchDelay time.Duration
+
+	// BatchSize is the most datums sent in each request, defaulting to the CloudWatch limit of 1000.
+	BatchSize int
+
+	// AuditFile, when set, records every request sent.
+	AuditFile string
+
+	// Progress shows a progress bar as the batches are sent, for runs in a terminal where status
+	// messages are shown as plain text.
+	Progress bool
+
+	// Verbose logs each request sent and the request ID of its response.
+	Verbose bool
+
+	// BisectOnFailure splits a batch rejected as invalid until the datums CloudWatch rejects
+	// are found, reporting each of them and publishing the rest.
+	BisectOnFailure bool
+}
+
+// batchSize will return the most datums to send in each request.
+func (o CloudWatchOptions) batchSize() int {
+	if o.BatchSize == 0 {
+		return maxDatumsPerRequest
+	}
+	return o.BatchSize
+}
+
+// NewCloudWatchPublisher will resolve the AWS configuration of each profile and create a client
+// for each of its regions.
+func NewCloudWatchPublisher(ctx context.Context, configInput Config, options CloudWatchOptions) (Publisher, error) {
+	if options.BatchSize < 0 || options.BatchSize > maxDatumsPerRequest {
+		return nil, ConfigError(fmt.Errorf("batch size %d is out of range, it must be between 1 and the CloudWatch limit of %d", options.BatchSize, maxDatumsPerRequest))
+	}
+
+	publisher := &cloudWatchPublisher{ctx: ctx, now: time.Now(), opts: options}
+	profiles := configInput.profiles()
+	for _, profile := range profiles {
+		profileInput := configInput
+		profileInput.Profile = profile
+		clients, err := newRegionClients(ctx, profileInput, options.Timeout)
+		if err != nil && len(profiles) > 1 {
+			return nil, fmt.Errorf("profile %s: %w", profile, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Several profiles are told apart in the outcome of each region.
+		if len(profiles) > 1 {
+			for i := range clients {
+				clients[i].label = fmt.Sprintf("%s with profile %s", clients[i].region, profile)
+			}
+		}
+		publisher.clients = append(publisher.clients, clients...)
+	}
+	return publisher, nil
+}
+
+// newRegionClients will resolve the AWS configuration of the profile and create a client for each
+// region. Unless only previewing, the caller identity is looked up so a wrong account is caught
+// before publishing.
+func newRegionClients(ctx context.Context, configInput Config, timeout time.Duration) ([]regionClient, error) {
+	cfg, err := loadAWSConfig(ctx, configInput, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var account, arn string
+	if !configInput.SkipPublish || configInput.ExpectedAccountID != "" {
+		account, arn, err = callerIdentity(ctx, cfg, timeout)
+		switch {
+		case err != nil && configInput.ExpectedAccountID != "":
+			return nil, ConfigError(fmt.Errorf("unable to confirm the AWS account is %s: %w", configInput.ExpectedAccountID, err))
+		case err != nil:
+			LogWarn(fmt.Sprintf("Unable to determine the AWS account: %v", err), "error", err)
+		case configInput.ExpectedAccountID != "" && account != configInput.ExpectedAccountID:
+			return nil, ConfigError(fmt.Errorf("credentials are for AWS account %s (%s), but account %s was expected", account, arn, configInput.ExpectedAccountID))
+		}
+	}
+
+	// Create a CloudWatch client for each region
+	var clients []regionClient
+	for _, region := range configInput.regions() {
+		clients = append(clients, regionClient{
+			region:  region,
+			label:   region,
+			profile: configInput.Profile,
+			account: account,
+			arn:     arn,
+			client: cloudwatch.NewFromConfig(cfg, func(o *cloudwatch.Options) {
+				o.Region = region
+			}),
+		})
+	}
+	return clients, nil
+}
+
+// newCloudWatchPublisherWithClient will create a publisher sending every request for the region
+// to the client, without resolving any AWS configuration, such as a fake recording the requests.
+func newCloudWatchPublisherWithClient(ctx context.Context, region string, client metricDataClient, options CloudWatchOptions) *cloudWatchPublisher {
+	clients := []regionClient{{region: region, label: region, client: client}}
+	return &cloudWatchPublisher{ctx: ctx, clients: clients, now: time.Now(), opts: options}
+}
+
+// loadAWSConfig will resolve the AWS configuration from the credentials and region in the config,
+// wrapping the credentials with those of the role when one is configured.
+func loadAWSConfig(ctx context.Context, configInput Config, timeout time.Duration) (aws.Config, error) {
+	if configInput.Region == "" {
+		return aws.Config{}, ConfigError(fmt.Errorf("AWS_REGION environment variable not set"))
+	}
+
+	if (configInput.AccessKeyID == "") != (configInput.SecretAccessKey == "") {
+		return aws.Config{}, ConfigError(fmt.Errorf("both an access key ID and secret access key are required for static credentials"))
+	}
+
+	if configInput.Profile == "" && !configInput.hasStaticCredentials() {
+		return aws.Config{}, ConfigError(fmt.Errorf("AWS_PROFILE environment variable not set"))
+	}
+
+	// Prepare AWS configuration options
+	var opts []func(*config.LoadOptions) error
+
+	// Add static credentials if provided, otherwise the profile if provided
+	if configInput.hasStaticCredentials() {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			configInput.AccessKeyID,
+			configInput.SecretAccessKey,
+			configInput.SessionToken,
+		)))
+	} else if configInput.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(configInput.Profile))
+	}
+
+	// Add region option if provided
+	if configInput.Region != "" {
+		opts = append(opts, config.WithRegion(configInput.Region))
+	}
+
+	// Send every request to the custom endpoint if provided, such as LocalStack
+	if configInput.EndpointURL != "" {
+		endpoint, err := url.Parse(configInput.EndpointURL)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return aws.Config{}, ConfigError(fmt.Errorf("endpoint URL %q must be an absolute http or https URL", configInput.EndpointURL))
+		}
+		opts = append(opts, config.WithBaseEndpoint(configInput.EndpointURL))
+	}
+
+	// Skip verifying the endpoint's certificate if requested, for self-signed local setups
+	if configInput.Insecure {
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		})))
+	}
+
+	// Load AWS configuration
+	loadCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cfg, err := config.LoadDefaultConfig(loadCtx, opts...)
+	err = deadlineError(err, timeout)
+	if err != nil {
+		return cfg, ConfigError(err)
+	}
+
+	// Assume the role if provided
+	if configInput.RoleARN != "" {
+		cfg.Credentials = assumeRole(cfg, configInput)
+	}
+	return cfg, nil
+}
+
+// callerIdentity will return the account ID and ARN of the credentials.
+func callerIdentity(ctx context.Context, cfg aws.Config, timeout time.Duration) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", "", deadlineError(err, timeout)
+	}
+	return aws.ToString(identity.Account), aws.ToString(identity.Arn), nil
+}
+
+// Describe will return the accounts and regions the metrics are published to, listing each
+// profile when there are several.
+func (p *cloudWatchPublisher) Describe() string {
+	var profiles []string
+	for _, c := range p.clients {
+		if !slices.Contains(profiles, c.profile) {
+			profiles = append(profiles, c.profile)
+		}
+	}
+	if len(profiles) == 1 {
+		return "CloudWatch" + describeTarget(p.clients)
+	}
+
+	targets := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		clients := slices.DeleteFunc(slices.Clone(p.clients), func(c regionClient) bool { return c.profile != profile })
+		targets = append(targets, "profile "+profile+describeTarget(clients))
+	}
+	return fmt.Sprintf("CloudWatch with %d profiles: %s", len(profiles), strings.Join(targets, "; "))
+}
+
+// describeTarget will describe the account and regions of the clients of a single profile.
+func describeTarget(clients []regionClient) string {
+	var target string
+	if clients[0].account != "" {
+		target += fmt.Sprintf(" in account %s (%s)", clients[0].account, clients[0].arn)
+	}
+	if len(clients) == 1 {
+		return fmt.Sprintf("%s in %s", target, clients[0].region)
+	}
+	regions := make([]string, 0, len(clients))
+	for _, c := range clients {
+		regions = append(regions, c.region)
+	}
+	return fmt.Sprintf("%s in %d regions (%s)", target, len(clients), strings.Join(regions, ", "))
+}
+
+// Publish will send the metrics to every region, reporting the outcome of each.
+func (p *cloudWatchPublisher) Publish(data PerformanceData, cfg Config) error {
+	batches := buildMetricBatches(data, cfg, p.now, p.opts.batchSize())
+	results := make([][]batchResult, len(p.clients))
+	for i := range results {
+		results[i] = make([]batchResult, len(batches))
+		for j := range results[i] {
+			results[i][j].err = errNotSent
+		}
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	progress := startProgress(p.opts.Progress, len(batches)*len(p.clients))
+
+	// Each job has its own slot in the results, so the workers never share one.
+	jobs := make(chan publishJob)
+	var wg sync.WaitGroup
+	for range max(p.opts.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := publishBatch(ctx, p.clients[job.client], batches[job.batch], p.opts)
+				results[job.client][job.batch] = result
+				progress.completed(batches[job.batch], result)
+				if result.err != nil && p.opts.FailFast {
+					cancel()
+				}
+			}
+		}()
+	}
+
+queue:
+	for i := range p.clients {
+		for j := range batches {
+			// Spacing out the batches keeps throttle-sensitive accounts under their limits.
+			if p.opts.BatchDelay > 0 && (i > 0 || j > 0) {
+				select {
+				case <-time.After(p.opts.BatchDelay):
+				case <-ctx.Done():
+					break queue
+				}
+			}
+			select {
+			case jobs <- publishJob{client: i, batch: j}:
+			case <-ctx.Done():
+				break queue
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	progress.stop()
+
+	// An interrupted publish reports how far it got, rather than every batch left unsent.
+	if p.ctx.Err() != nil {
+		var published int
+		for i := range results {
+			for _, result := range results[i] {
+				if result.err == nil {
+					published++
+				}
+			}
+		}
+		err := InterruptedError(fmt.Errorf("interrupted after %d of %d batches were published", published, len(batches)*len(p.clients)))
+		return withFailedKeys(err, unpublishedKeys(batches, results), publishedDatums(batches, results))
+	}
+
+	var errs []error
+	for i, c := range p.clients {
+		err := reportBatches(c.label, batches, results[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("region %s: %w", c.label, err))
+		}
+	}
+	return withFailedKeys(errors.Join(errs...), unpublishedKeys(batches, results), publishedDatums(batches, results))
+}
+
+// publishedDatums will return how many datums were published, counting those of the region with
+// the fewest when there are several, as the same datums are sent to each.
+func publishedDatums(batches []metricBatch, results [][]batchResult) int {
+	fewest := -1
+	for i := range results {
+		var published int
+		for j, result := range results[i] {
+			published += result.published(batches[j])
+		}
+		if fewest < 0 || published < fewest {
+			fewest = published
+		}
+	}
+	return max(fewest, 0)
+}
+
+// unpublishedKeys will return the sorted data keys of the batches which failed or were not
+// sent to any of the regions.
+func unpublishedKeys(batches []metricBatch, results [][]batchResult) []string {
+	var keys []string
+	for i := range results {
+		for j, result := range results[i] {
+			switch {
+			case result.err == nil:
+			case result.failedKeys != nil:
+				keys = append(keys, result.failedKeys...)
+			default:
+				keys = append(keys, batches[j].keys...)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// batches will return how many PutMetricData requests the data is sent in, across every region.
+func (p *cloudWatchPublisher) batches(data PerformanceData, cfg Config) int {
+	return len(buildMetricBatches(data, cfg, p.now, p.opts.batchSize())) * len(p.clients)
+}
+
+// printPayload will print the PutMetricData requests which are going to be sent.
+func (p *cloudWatchPublisher) printPayload(w io.Writer, data PerformanceData, cfg Config) error {
+	return printJSON(w, buildMetricBatches(data, cfg, p.now, p.opts.batchSize()))
+}
+
+// assumeRole will wrap the loaded credentials with those of the configured role.
+func assumeRole(cfg aws.Config, configInput Config) aws.CredentialsProvider {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), configInput.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		if configInput.ExternalID != "" {
+			o.ExternalID = aws.String(configInput.ExternalID)
+		}
+		if configInput.RoleSessionName != "" {
+			o.RoleSessionName = configInput.RoleSessionName
+		}
+	})
+	return aws.NewCredentialsCache(provider)
+}
+
+// regionClient is a CloudWatch client for a single region of a profile.
+type regionClient struct {
+	region string
+	client metricDataClient
+
+	// label names the region in the outcome, along with the profile when there are several.
+	label string
+
+	// profile, account and arn identify who the metrics are published as, with the account
+	// and arn only set when they could be looked up.
+	profile string
+	account string
+	arn     string
+}
+
+// metricDataClient is the part of the CloudWatch client used to publish and look up metrics,
+// so the publisher can be given a fake which records the requests instead.
+type metricDataClient interface {
+	cloudwatch.GetMetricDataAPIClient
+	PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// publishProgress is a progress bar advancing as each batch completes, titled with the number
+// of datums published so far.
+type publishProgress struct {
+	mu     sync.Mutex
+	bar    *pterm.ProgressbarPrinter
+	datums int
+}
+
+// startProgress will show the progress bar for the batches, unless it is disabled or there is only
+// a single batch. A nil progress is returned when not shown, which ignores the batches.
+func startProgress(enabled bool, total int) *publishProgress {
+	if !enabled || total < 2 {
+		return nil
+	}
+	bar, err := pterm.DefaultProgressbar.WithTotal(total).WithTitle("Publishing").WithWriter(statusWriter()).Start()
+	if err != nil {
+		return nil
+	}
+	return &publishProgress{bar: bar}
+}
+
+// completed will advance the progress bar for the batch, counting its datums when it was published.
+func (p *publishProgress) completed(batch metricBatch, result batchResult) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.datums += result.published(batch)
+	p.bar.UpdateTitle(fmt.Sprintf("Published %d datums", p.datums))
+	p.bar.Increment()
+}
+
+// stop will stop redrawing the progress bar, leaving it showing the datums published.
+func (p *publishProgress) stop() {
+	if p == nil {
+		return
+	}
+	_, _ = p.bar.Stop()
+}
+
+// errNotSent is the result of a batch which was not sent because --fail-fast stopped the publish.
+var errNotSent = errors.New("not sent after an earlier failure")
+
+// publishJob is a batch to send to one of the regions.
+type publishJob struct {
+	client int
+	batch  int
+}
+
+// batchResult is the outcome of sending a batch, and of recording it in the audit file.
+type batchResult struct {
+	err      error
+	auditErr error
+
+	// failedKeys are the data keys of the datums which failed once the batch was bisected, the
+	// rest of the batch being published. It is nil when the batch was not bisected.
+	failedKeys []string
+}
+
+// published will return how many of the datums of the batch were published.
+func (r batchResult) published(batch metricBatch) int {
+	switch {
+	case r.err == nil:
+		return len(batch.input.MetricData)
+	case r.failedKeys != nil:
+		return len(batch.input.MetricData) - len(r.failedKeys)
+	}
+	return 0
+}
+
+// publishBatch will send the batch to the region, recording the attempt in the audit file. When
+// bisecting, a batch rejected as invalid is split to find the datums which are rejected.
+func publishBatch(ctx context.Context, c regionClient, batch metricBatch, opts CloudWatchOptions) batchResult {
+	var result batchResult
+	result.err = result.send(ctx, c, batch, opts)
+	if result.err == nil || !opts.BisectOnFailure || len(batch.keys) < 2 || !isInvalidRequest(result.err) {
+		return result
+	}
+
+	LogWarn(fmt.Sprintf("Batch of datums %d-%d in namespace %s was rejected, splitting it to find the invalid datums: %v", batch.start+1, batch.end, *batch.input.Namespace, result.err),
+		"namespace", *batch.input.Namespace, "start", batch.start+1, "end", batch.end, "error", result.err)
+	result.failedKeys = []string{}
+	result.err = errors.Join(result.bisect(ctx, c, batch, opts)...)
+	return result
+}
+
+// send will send the batch, recording the attempt in the audit file.
+func (r *batchResult) send(ctx context.Context, c regionClient, batch metricBatch, opts CloudWatchOptions) error {
+	err := putMetricData(ctx, c.client, batch.input, opts)
+	if opts.AuditFile != "" {
+		if auditErr := writeAuditRecord(opts.AuditFile, c.region, batch.input, err); auditErr != nil {
+			r.auditErr = auditErr
+		}
+	}
+	return err
+}
+
+// bisect will send each half of the rejected batch, splitting those which are rejected again
+// until the invalid datums are found, and return an error for each datum or half which failed.
+func (r *batchResult) bisect(ctx context.Context, c regionClient, batch metricBatch, opts CloudWatchOptions) []error {
+	middle := len(batch.keys) / 2
+	var errs []error
+	for _, half := range []metricBatch{splitBatch(batch, 0, middle), splitBatch(batch, middle, len(batch.keys))} {
+		err := r.send(ctx, c, half, opts)
+		switch {
+		case err == nil:
+		case len(half.keys) > 1 && isInvalidRequest(err):
+			errs = append(errs, r.bisect(ctx, c, half, opts)...)
+		case len(half.keys) == 1:
+			r.failedKeys = append(r.failedKeys, half.keys...)
+			errs = append(errs, fmt.Errorf("datum %d for data key %q, metric %s, was rejected: %w", half.start+1, half.keys[0], aws.ToString(half.input.MetricData[0].MetricName), err))
+		default:
+			r.failedKeys = append(r.failedKeys, half.keys...)
+			errs = append(errs, fmt.Errorf("datums %d-%d failed: %w", half.start+1, half.end, err))
+		}
+	}
+	return errs
+}
+
+// splitBatch will return the datums of the batch from the start up to the end, counted from
+// the start of the batch.
+func splitBatch(batch metricBatch, start, end int) metricBatch {
+	input := *batch.input
+	input.MetricData = batch.input.MetricData[start:end]
+	return metricBatch{
+		input: &input,
+		start: batch.start + start,
+		end:   batch.start + end,
+		keys:  batch.keys[start:end],
+	}
+}
+
+// reportBatches will log how many of the batches were published to the region, labelled with
+// its profile when there are several, and return the failures so they can all be reported.
+func reportBatches(region string, batches []metricBatch, results []batchResult) error {
+	var errs []error
+	var sent, published int
+	for i, batch := range batches {
+		result := results[i]
+		if result.auditErr != nil {
+			errs = append(errs, fmt.Errorf("unable to write audit record: %w", result.auditErr))
+		}
+		published += result.published(batch)
+		switch {
+		case result.err == nil:
+			sent++
+		case result.failedKeys != nil:
+			sent++
+			errs = append(errs, fmt.Errorf("batch of datums %d-%d in namespace %s was published without %d rejected datums: %w", batch.start+1, batch.end, *batch.input.Namespace, len(result.failedKeys), result.err))
+		default:
+			errs = append(errs, fmt.Errorf("batch of datums %d-%d in namespace %s failed: %w", batch.start+1, batch.end, *batch.input.Namespace, result.err))
+		}
+	}
+	LogInfo(fmt.Sprintf("Published %d datums in %d batches to %s.", published, sent, region), "region", region, "published", published, "batches", sent, "failed", len(errs))
+	return errors.Join(errs...)
+}
+
+// putMetricData will send the request, retrying throttling and server errors with exponential backoff.
+func putMetricData(ctx context.Context, client metricDataClient, input *cloudwatch.PutMetricDataInput, opts CloudWatchOptions) error {
+	if opts.Verbose {
+		logRequest(input)
+	}
+	for attempt := 0; ; attempt++ {
+		requestCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		// Retries are handled here rather than by the SDK so they can be reported.
+		output, err := client.PutMetricData(requestCtx, input, func(o *cloudwatch.Options) {
+			o.RetryMaxAttempts = 1
+		})
+		cancel()
+		if opts.Verbose {
+			logResponse(input, output, err)
+		}
+		if err == nil || attempt >= opts.MaxRetries || !isRetryable(err) {
+			return deadlineError(err, opts.Timeout)
+		}
+
+		delay := retryDelay(attempt)
+		LogWarn(fmt.Sprintf("Request to namespace %s failed, retrying in %s (retry %d of %d): %v", *input.Namespace, delay.Round(time.Millisecond), attempt+1, opts.MaxRetries, err),
+			"namespace", *input.Namespace, "retry", attempt+1, "maxRetries", opts.MaxRetries, "delay", delay.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// logRequest will log the request as indented JSON.
+func logRequest(input *cloudwatch.PutMetricDataInput) {
+	out, err := json.MarshalIndent(input, "", "  ")
+	if err != nil {
+		LogWarn(fmt.Sprintf("Unable to log the request: %v", err), "error", err)
+		return
+	}
+	LogDebug(fmt.Sprintf("Sending PutMetricData request to namespace %s:\n%s", *input.Namespace, out), "namespace", *input.Namespace, "datums", len(input.MetricData))
+}
+
+// logResponse will log the request ID of the response, which AWS support asks for when
+// diagnosing a request.
+func logResponse(input *cloudwatch.PutMetricDataInput, output *cloudwatch.PutMetricDataOutput, err error) {
+	var requestID string
+	var respErr *awshttp.ResponseError
+	switch {
+	case errors.As(err, &respErr):
+		requestID = respErr.ServiceRequestID()
+	case output != nil:
+		requestID, _ = awsmiddleware.GetRequestIDMetadata(output.ResultMetadata)
+	}
+	if requestID == "" {
+		requestID = "unknown"
+	}
+	status := "succeeded"
+	if err != nil {
+		status = "failed"
+	}
+	LogDebug(fmt.Sprintf("PutMetricData request to namespace %s %s with request ID %s.", *input.Namespace, status, requestID), "namespace", *input.Namespace, "requestId", requestID, "error", err)
+}
+
+// isRetryable will report whether the error is due to throttling or a transient server failure.
+func isRetryable(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+			return true
+		}
+	}
+
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() >= 500
+	}
+	return false
+}
+
+// isInvalidRequest will report whether the error is CloudWatch rejecting the request as invalid,
+// which is usually caused by one of its datums.
+func isInvalidRequest(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidParameterValue", "InvalidParameterCombination", "MissingParameter", "MissingRequiredParameter", "ValidationError":
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay will return the exponential backoff for the attempt with jitter
+// applied, capped once the attempt reaches maxRetryBackoffShift.
+func retryDelay(attempt int) time.Duration {
+	backoff := retryBaseDelay << min(attempt, maxRetryBackoffShift)
+	return backoff/2 + rand.N(backoff/2)
+}
+
+// buildMetricBatches will convert the data into the requests to be sent, grouped by namespace.
+// Each request holds at most size datums.
+func buildMetricBatches(data PerformanceData, config Config, now time.Time, size int) []metricBatch {
+	metricData := make(map[string][]types.MetricDatum)
+	metricKeys := make(map[string][]string)
+
+	for _, key := range data.keys() {
+		metric, ok := config.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		value := data[key]
+
+		metricDatum := types.MetricDatum{
+			MetricName:        aws.String(metric.Name),
+			Timestamp:         aws.Time(value.timestamp(now)),
+			Unit:              metric.unit(),
+			StorageResolution: aws.Int32(config.storageResolution(metric)),
+		}
+
+		if value.Statistics != nil {
+			metricDatum.StatisticValues = &types.StatisticSet{
+				SampleCount: aws.Float64(value.Statistics.SampleCount),
+				Sum:         aws.Float64(roundValue(value.Statistics.Sum, config.precision())),
+				Minimum:     aws.Float64(roundValue(value.Statistics.Minimum, config.precision())),
+				Maximum:     aws.Float64(roundValue(value.Statistics.Maximum, config.precision())),
+			}
+		} else {
+			metricDatum.Value = aws.Float64(roundValue(value.Value, config.precision()))
+		}
+
+		for _, dimension := range config.dimensions(metric) {
+			metricDatum.Dimensions = append(metricDatum.Dimensions, types.Dimension{
+				Name:  &dimension.Name,
+				Value: &dimension.Value,
+			})
+		}
+
+		namespace := metric.namespace(config.MetricNamespace)
+		metricData[namespace] = append(metricData[namespace], metricDatum)
+		metricKeys[namespace] = append(metricKeys[namespace], key)
+	}
+
+	namespaces := make([]string, 0, len(metricData))
+	for namespace := range metricData {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var batches []metricBatch
+	for _, namespace := range namespaces {
+		batches = append(batches, batchMetricData(namespace, metricData[namespace], metricKeys[namespace], size)...)
+	}
+	return batches
+}
+
+// metricBatch is a single request along with the range of the namespace's datums it holds.
+type metricBatch struct {
+	input *cloudwatch.PutMetricDataInput
+	start int
+	end   int
+
+	// keys are the data keys of the datums, in the same order.
+	keys []string
+}
+
+// batchMetricData will split the datums for a namespace, and their data keys, into requests
+// of at most size entries.
+func batchMetricData(namespace string, metricData []types.MetricDatum, keys []string, size int) []metricBatch {
+	var batches []metricBatch
+	for start := 0; start < len(metricData); start += size {
+		end := min(start+size, len(metricData))
+		batches = append(batches, metricBatch{
+			input: &cloudwatch.PutMetricDataInput{
+				Namespace:  aws.String(namespace),
+				MetricData: metricData[start:end],
+			},
+			start: start,
+			end:   end,
+			keys:  keys[start:end],
+		})
+	}
+	return batches
+}
+
+// printCommands will print an AWS CLI command for each request which would be sent to each region.
+func (p *cloudWatchPublisher) printCommands(w io.Writer, data PerformanceData, cfg Config) error {
+	batches := buildMetricBatches(data, cfg, p.now, p.opts.batchSize())
+	for _, c := range p.clients {
+		for _, batch := range batches {
+			command, err := awsCLICommand(c.region, c.profile, batch.input)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(w, command); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// awsCLIDatum is a metric datum in the shape accepted by the AWS CLI's --metric-data option.
+type awsCLIDatum struct {
+	MetricName        string              `json:"MetricName"`
+	Dimensions        []awsCLIDimension   `json:"Dimensions,omitempty"`
+	Timestamp         string              `json:"Timestamp,omitempty"`
+	Value             *float64            `json:"Value,omitempty"`
+	StatisticValues   *types.StatisticSet `json:"StatisticValues,omitempty"`
+	Unit              types.StandardUnit  `json:"Unit,omitempty"`
+	StorageResolution *int32              `json:"StorageResolution,omitempty"`
+}
+
+// awsCLIDimension is a dimension in the shape accepted by the AWS CLI.
+type awsCLIDimension struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+// awsCLICommand will render the request as an aws cloudwatch put-metric-data command.
+func awsCLICommand(region, profile string, input *cloudwatch.PutMetricDataInput) (string, error) {
+	datums := make([]awsCLIDatum, 0, len(input.MetricData))
+	for _, datum := range input.MetricData {
+		cliDatum := awsCLIDatum{
+			MetricName:        aws.ToString(datum.MetricName),
+			Value:             datum.Value,
+			StatisticValues:   datum.StatisticValues,
+			Unit:              datum.Unit,
+			StorageResolution: datum.StorageResolution,
+		}
+		if datum.Timestamp != nil {
+			cliDatum.Timestamp = datum.Timestamp.UTC().Format(time.RFC3339)
+		}
+		for _, dimension := range datum.Dimensions {
+			cliDatum.Dimensions = append(cliDatum.Dimensions, awsCLIDimension{
+				Name:  aws.ToString(dimension.Name),
+				Value: aws.ToString(dimension.Value),
+			})
+		}
+		datums = append(datums, cliDatum)
+	}
+
+	metricData, err := json.Marshal(datums)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"aws", "cloudwatch", "put-metric-data", "--region", shellQuote(region)}
+	if profile != "" {
+		args = append(args, "--profile", shellQuote(profile))
+	}
+	args = append(args, "--namespace", shellQuote(aws.ToString(input.Namespace)), "--metric-data", shellQuote(string(metricData)))
+	return strings.Join(args, " "), nil
+}
+
+// shellQuote will quote the value for pasting into a POSIX shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// printJSON will print the requests which are going to be sent as indented JSON.
+func printJSON(w io.Writer, batches []metricBatch) error {
+	inputs := make([]*cloudwatch.PutMetricDataInput, 0, len(batches))
+	for _, batch := range batches {
+		inputs = append(inputs, batch.input)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inputs)
+}
+
+// deadlineError will explain errors caused by an operation exceeding the timeout.
+func deadlineError(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("operation exceeded the %s deadline: %w", timeout, err)
+	}
+	return err
+}
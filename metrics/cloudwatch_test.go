@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/smithy-go"
+)
+
+// recordingClient is a fake CloudWatch client which records every PutMetricData request,
+// rejecting those holding a metric whose name starts with reject.
+type recordingClient struct {
+	mu     sync.Mutex
+	inputs []*cloudwatch.PutMetricDataInput
+	reject string
+}
+
+func (c *recordingClient) PutMetricData(_ context.Context, params *cloudwatch.PutMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inputs = append(c.inputs, params)
+	if c.reject != "" && slices.ContainsFunc(params.MetricData, func(d types.MetricDatum) bool {
+		return strings.HasPrefix(aws.ToString(d.MetricName), c.reject)
+	}) {
+		return nil, &smithy.GenericAPIError{Code: "InvalidParameterValue", Message: "rejected"}
+	}
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
+
+func (c *recordingClient) GetMetricData(context.Context, *cloudwatch.GetMetricDataInput, ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+	return &cloudwatch.GetMetricDataOutput{}, nil
+}
+
+// requests will return the namespace and metric names of each recorded request, in order.
+func (c *recordingClient) requests() []string {
+	var requests []string
+	for _, input := range c.inputs {
+		names := make([]string, 0, len(input.MetricData))
+		for _, datum := range input.MetricData {
+			names = append(names, aws.ToString(datum.MetricName))
+		}
+		requests = append(requests, aws.ToString(input.Namespace)+": "+strings.Join(names, ","))
+	}
+	return requests
+}
+
+func newTestPublisher(t *testing.T, client *recordingClient, options CloudWatchOptions) *cloudWatchPublisher {
+	t.Helper()
+	options.Timeout = time.Second
+	return newCloudWatchPublisherWithClient(context.Background(), "ap-southeast-2", client, options)
+}
+
+func TestPublishBatchesByNamespaceAndSize(t *testing.T) {
+	config := Config{
+		MetricNamespace: "Personal",
+		MetricMappings: map[string]MetricMapping{
+			"a": {Name: "A"},
+			"b": {Name: "B"},
+			"c": {Name: "C"},
+			"d": {Name: "D", Namespace: "Other"},
+		},
+	}
+	data := PerformanceData{"a": {Value: 1}, "b": {Value: 2}, "c": {Value: 3}, "d": {Value: 4}}
+
+	client := &recordingClient{}
+	if err := newTestPublisher(t, client, CloudWatchOptions{BatchSize: 2}).Publish(data, config); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	want := []string{"Other: D", "Personal: A,B", "Personal: C"}
+	if got := client.requests(); !slices.Equal(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestPublishDefaultBatchSize(t *testing.T) {
+	config := Config{MetricNamespace: "Personal", MetricMappings: map[string]MetricMapping{}}
+	data := PerformanceData{}
+	for i := range maxDatumsPerRequest + 1 {
+		key := fmt.Sprintf("key%04d", i)
+		config.MetricMappings[key] = MetricMapping{Name: key}
+		data[key] = MetricValue{Value: float64(i)}
+	}
+
+	client := &recordingClient{}
+	if err := newTestPublisher(t, client, CloudWatchOptions{}).Publish(data, config); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	if len(client.inputs) != 2 || len(client.inputs[0].MetricData) != maxDatumsPerRequest || len(client.inputs[1].MetricData) != 1 {
+		t.Errorf("got %d requests, want one of %d datums and one of 1", len(client.inputs), maxDatumsPerRequest)
+	}
+}
+
+func TestPublishDatumMapping(t *testing.T) {
+	high := true
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	config := Config{
+		MetricNamespace:     "Personal",
+		DimensionNamePrefix: "team_",
+		DefaultDimensions:   []MetricMappingDimensions{{Name: "Env", Value: "prod"}, {Name: "Goal", Value: "Default"}},
+		MetricMappings: map[string]MetricMapping{
+			"steps":   {Name: "Steps", Dimensions: []MetricMappingDimensions{{Name: "Goal", Value: "Fitness"}}},
+			"latency": {Name: "Latency", Unit: "Milliseconds", HighResolution: &high},
+		},
+	}
+	data := PerformanceData{
+		"steps":   {Value: 1234.5678, Timestamp: &timestamp},
+		"latency": {Statistics: &StatisticSet{SampleCount: 3, Sum: 30.123, Minimum: 5, Maximum: 15}},
+	}
+
+	client := &recordingClient{}
+	publisher := newTestPublisher(t, client, CloudWatchOptions{})
+	if err := publisher.Publish(data, config); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if len(client.inputs) != 1 || len(client.inputs[0].MetricData) != 2 {
+		t.Fatalf("requests = %q, want a single request of 2 datums", client.requests())
+	}
+
+	latency, steps := client.inputs[0].MetricData[0], client.inputs[0].MetricData[1]
+	if aws.ToString(steps.MetricName) != "Steps" || aws.ToFloat64(steps.Value) != 1234.57 || steps.Unit != types.StandardUnitCount {
+		t.Errorf("steps datum = %s %v %s, want Steps 1234.57 Count", aws.ToString(steps.MetricName), aws.ToFloat64(steps.Value), steps.Unit)
+	}
+	if !aws.ToTime(steps.Timestamp).Equal(timestamp) || aws.ToInt32(steps.StorageResolution) != standardStorageResolution {
+		t.Errorf("steps timestamp and resolution = %s %d, want %s %d", aws.ToTime(steps.Timestamp), aws.ToInt32(steps.StorageResolution), timestamp, standardStorageResolution)
+	}
+	var dimensions []string
+	for _, dimension := range steps.Dimensions {
+		dimensions = append(dimensions, aws.ToString(dimension.Name)+"="+aws.ToString(dimension.Value))
+	}
+	if want := []string{"team_Env=prod", "team_Goal=Fitness"}; !slices.Equal(dimensions, want) {
+		t.Errorf("steps dimensions = %q, want %q", dimensions, want)
+	}
+
+	if latency.Value != nil || latency.StatisticValues == nil || aws.ToFloat64(latency.StatisticValues.Sum) != 30.12 || aws.ToFloat64(latency.StatisticValues.SampleCount) != 3 {
+		t.Errorf("latency datum = %+v, want a statistic set with a sum of 30.12 from 3 samples", latency)
+	}
+	if latency.Unit != types.StandardUnitMilliseconds || aws.ToInt32(latency.StorageResolution) != highStorageResolution || !aws.ToTime(latency.Timestamp).Equal(publisher.now) {
+		t.Errorf("latency unit, resolution and timestamp = %s %d %s, want Milliseconds %d %s", latency.Unit, aws.ToInt32(latency.StorageResolution), aws.ToTime(latency.Timestamp), highStorageResolution, publisher.now)
+	}
+}
+
+func TestPublishPartialFailure(t *testing.T) {
+	config := Config{
+		MetricNamespace: "Personal",
+		MetricMappings:  map[string]MetricMapping{"a": {Name: "A"}, "b": {Name: "B"}, "c": {Name: "BadC"}, "d": {Name: "D"}},
+	}
+	data := PerformanceData{"a": {Value: 1}, "b": {Value: 2}, "c": {Value: 3}, "d": {Value: 4}}
+
+	tests := []struct {
+		name      string
+		options   CloudWatchOptions
+		failed    []string
+		published int
+	}{
+		{name: "failed batch", options: CloudWatchOptions{BatchSize: 2}, failed: []string{"c", "d"}, published: 2},
+		{name: "bisected batch", options: CloudWatchOptions{BisectOnFailure: true}, failed: []string{"c"}, published: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &recordingClient{reject: "Bad"}
+			err := newTestPublisher(t, client, tt.options).Publish(data, config)
+			if err == nil {
+				t.Fatal("publish succeeded, want an error for the rejected datum")
+			}
+			var apiErr smithy.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidParameterValue" {
+				t.Errorf("error = %v, want the InvalidParameterValue from CloudWatch", err)
+			}
+			if got := FailedKeys(err); !slices.Equal(got, tt.failed) {
+				t.Errorf("failed keys = %q, want %q", got, tt.failed)
+			}
+			if got := publishedCount(err); got != tt.published {
+				t.Errorf("published = %d, want %d", got, tt.published)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// CombinedConfigSection is the key of the configuration in a combined file.
+	CombinedConfigSection = "config"
+
+	// CombinedDataSection is the key of the data in a combined file.
+	CombinedDataSection = "data"
+)
+
+// LoadCombinedConfig will load the configuration from the config section of the combined file,
+// merging in the overlay for the environment when one is given, as LoadConfig does.
+func LoadCombinedConfig(path string, opts ConfigOptions) (Config, error) {
+	file, err := CombinedSection(path, CombinedConfigSection)
+	if err != nil {
+		return Config{}, err
+	}
+	if opts.Env != "" {
+		file, err = overlayConfig(file, path, opts.Env)
+		if err != nil {
+			return Config{}, ConfigError(err)
+		}
+	}
+	return parseConfig(file, opts)
+}
+
+// LoadCombinedData will load the data from the data section of the combined file, flattening
+// nested keys and validating it as LoadData does.
+func LoadCombinedData(path string, opts DataOptions) (PerformanceData, error) {
+	file, err := CombinedSection(path, CombinedDataSection)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeYAML(file, opts.keySeparator())
+	if err != nil {
+		return nil, ConfigError(fmt.Errorf("unable to decode the data section of %s: %w", path, err))
+	}
+	return data, ValidationError(validateData(data))
+}
+
+// CombinedSection will return the section of the combined file as a YAML document of its own.
+// The file is YAML or JSON with only the config and data sections at the top level.
+func CombinedSection(path string, section string) ([]byte, error) {
+	file, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ConfigError(fmt.Errorf("combined file not found: %s", path))
+	}
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(file, &document); err != nil {
+		return nil, ConfigError(fmt.Errorf("unable to parse combined file %s: %w", path, err))
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, ConfigError(fmt.Errorf("combined file %s must be a mapping with %s and %s sections", path, CombinedConfigSection, CombinedDataSection))
+	}
+
+	root := document.Content[0]
+	var value *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch key := root.Content[i]; key.Value {
+		case section:
+			value = root.Content[i+1]
+		case CombinedConfigSection, CombinedDataSection:
+		default:
+			return nil, ConfigError(fmt.Errorf("line %d: unknown section %q in combined file %s, expected %s and %s", key.Line, key.Value, path, CombinedConfigSection, CombinedDataSection))
+		}
+	}
+	if value == nil {
+		return nil, ConfigError(fmt.Errorf("combined file %s has no %s section", path, section))
+	}
+
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, ConfigError(err)
+	}
+	return out, nil
+}
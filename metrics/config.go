@@ -0,0 +1,822 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Config provides global configuration
+type Config struct {
+	Version           int      `yaml:"version"`
+	Region            string   `yaml:"region"`
+	AdditionalRegions []string `yaml:"additionalRegions"`
+	Profile           string   `yaml:"profile"`
+	Profiles          []string `yaml:"profiles"`
+	AccessKeyID       string   `yaml:"accessKeyId"`
+	SecretAccessKey   string   `yaml:"secretAccessKey"`
+	SessionToken      string   `yaml:"sessionToken"`
+	RoleARN           string   `yaml:"roleArn"`
+	ExternalID        string   `yaml:"externalId"`
+	RoleSessionName   string   `yaml:"roleSessionName"`
+	ExpectedAccountID string   `yaml:"expectedAccountId"`
+	EndpointURL       string   `yaml:"endpointUrl"`
+	Insecure          bool     `yaml:"insecure"`
+	ConfirmDefault    bool     `yaml:"confirmDefault"`
+	SkipPublish       bool     `yaml:"skipPublish"`
+	Precision         *int     `yaml:"precision"`
+
+	// DefaultStorageResolution is the storage resolution in seconds, 1 or 60, of metrics which
+	// do not set highResolution themselves.
+	DefaultStorageResolution int `yaml:"defaultStorageResolution"`
+
+	MetricNamespace string `yaml:"metricNamespace"`
+	MetaNamespace   string `yaml:"metaNamespace"`
+
+	// DimensionNamePrefix is prepended to the name of every dimension when publishing,
+	// so metrics in a shared account can be told apart by team.
+	DimensionNamePrefix string `yaml:"dimensionNamePrefix"`
+
+	// SortDimensions sorts the dimensions of every metric by name, rather than keeping the
+	// order of the config. CloudWatch treats the order as part of the metric's identity.
+	SortDimensions bool `yaml:"sortDimensions"`
+
+	DefaultDimensions []MetricMappingDimensions            `yaml:"defaultDimensions"`
+	DimensionSets     map[string][]MetricMappingDimensions `yaml:"dimensionSets"`
+	MetricMappings    map[string]MetricMapping             `yaml:"metricMappings"`
+
+	// DerivedMetrics are data keys computed from an expression over the other data keys,
+	// such as errors / requests * 100.
+	DerivedMetrics map[string]string `yaml:"derivedMetrics"`
+
+	// Environments are the region, profile and namespace to use for each environment,
+	// selected with --env in place of the top-level values.
+	Environments map[string]Environment `yaml:"environments"`
+
+	// unitOverride is the unit set for every metric by OverrideUnits.
+	unitOverride string
+
+	// inferUnits is set by InferUnits, so passthrough mappings have their units inferred too.
+	inferUnits bool
+}
+
+// Environment is where the metrics of an environment are published, with any empty field
+// keeping the top-level value.
+type Environment struct {
+	Region    string `yaml:"region"`
+	Profile   string `yaml:"profile"`
+	Namespace string `yaml:"namespace"`
+}
+
+// applyEnvironment will replace the region, profile and namespace with those set for the
+// environment, when the config defines it.
+func applyEnvironment(cfg *Config, env string) {
+	environment, ok := cfg.Environments[env]
+	if !ok {
+		return
+	}
+	if environment.Region != "" {
+		cfg.Region = environment.Region
+	}
+	if environment.Profile != "" {
+		cfg.Profile = environment.Profile
+	}
+	if environment.Namespace != "" {
+		cfg.MetricNamespace = environment.Namespace
+	}
+}
+
+// definesEnvironment will report whether the environments of the config document include the
+// environment, in which case it does not need an overlay of its own.
+func definesEnvironment(file []byte, env string) bool {
+	var document yaml.Node
+	if err := yaml.Unmarshal(file, &document); err != nil || len(document.Content) == 0 {
+		return false
+	}
+	environments := mappingValue(document.Content[0], "environments")
+	return environments != nil && environments.Kind == yaml.MappingNode && mappingValue(environments, env) != nil
+}
+
+// hasStaticCredentials will report whether explicit access keys have been configured.
+func (c Config) hasStaticCredentials() bool {
+	return c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// withoutSecrets will return a copy of the config with the static credentials masked, so it
+// can be logged.
+func (c Config) withoutSecrets() Config {
+	for _, secret := range []*string{&c.AccessKeyID, &c.SecretAccessKey, &c.SessionToken} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	return c
+}
+
+// logConfig will log the resolved config without its secrets.
+func logConfig(c Config) {
+	var node yaml.Node
+	var out strings.Builder
+	err := node.Encode(c.withoutSecrets())
+	if err == nil {
+		err = encodeYAML(&out, &node)
+	}
+	if err != nil {
+		LogWarn(fmt.Sprintf("Unable to log the resolved config: %v", err), "error", err)
+		return
+	}
+	LogDebug("Resolved config:\n"+strings.TrimSpace(out.String()), "config", out.String())
+}
+
+// profiles will return the profiles to publish with, the profiles when several are configured
+// or otherwise the profile. Static credentials take precedence over every profile.
+func (c Config) profiles() []string {
+	if len(c.Profiles) == 0 || c.hasStaticCredentials() {
+		return []string{c.Profile}
+	}
+	var profiles []string
+	for _, profile := range c.Profiles {
+		if !slices.Contains(profiles, profile) {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// regions will return the primary region followed by any additional regions, without duplicates.
+func (c Config) regions() []string {
+	regions := []string{c.Region}
+	for _, region := range c.AdditionalRegions {
+		if !slices.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// precision will return the number of decimal places values are rounded to, defaulting to 2.
+func (c Config) precision() int {
+	if c.Precision == nil {
+		return defaultPrecision
+	}
+	return *c.Precision
+}
+
+// dimensions will return the default dimensions merged with those of the metric,
+// with the metric's dimensions taking precedence when the names collide, and the
+// dimension name prefix applied to each. They are sorted by name when SortDimensions is set.
+func (c Config) dimensions(metric MetricMapping) []MetricMappingDimensions {
+	dimensions := mergeDimensions(c.DefaultDimensions, metric.Dimensions)
+	for i := range dimensions {
+		dimensions[i] = c.prefixDimension(dimensions[i])
+	}
+	if c.SortDimensions {
+		slices.SortStableFunc(dimensions, func(a, b MetricMappingDimensions) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+	return dimensions
+}
+
+// prefixDimension will return the dimension with the dimension name prefix applied.
+func (c Config) prefixDimension(dimension MetricMappingDimensions) MetricMappingDimensions {
+	dimension.Name = c.DimensionNamePrefix + dimension.Name
+	return dimension
+}
+
+// mergeDimensions will return the base dimensions followed by the overrides, with
+// the overrides replacing any base dimensions of the same name. An override stays
+// sensitive when the dimension it replaces is.
+func mergeDimensions(base, overrides []MetricMappingDimensions) []MetricMappingDimensions {
+	var dimensions []MetricMappingDimensions
+	for _, dimension := range base {
+		overridden := slices.ContainsFunc(overrides, func(d MetricMappingDimensions) bool {
+			return d.Name == dimension.Name
+		})
+		if !overridden {
+			dimensions = append(dimensions, dimension)
+		}
+	}
+	for _, override := range overrides {
+		override.Sensitive = override.Sensitive || slices.ContainsFunc(base, func(d MetricMappingDimensions) bool {
+			return d.Name == override.Name && d.Sensitive
+		})
+		dimensions = append(dimensions, override)
+	}
+	return dimensions
+}
+
+// MetricMapping is the configuration data for the metrics.
+type MetricMapping struct {
+	Name           string                    `yaml:"name"`
+	Namespace      string                    `yaml:"namespace"`
+	Unit           string                    `yaml:"unit"`
+	HighResolution *bool                     `yaml:"highResolution"`
+	Type           string                    `yaml:"type"`
+	Scale          *float64                  `yaml:"scale"`
+	Offset         float64                   `yaml:"offset"`
+	DimensionSet   string                    `yaml:"dimensionSet"`
+	Dimensions     []MetricMappingDimensions `yaml:"dimensions"`
+
+	// Warn and Critical are display-only thresholds, crossed when the value goes past
+	// them in the ThresholdDirection, which is above unless set to below.
+	Warn               *float64 `yaml:"warn"`
+	Critical           *float64 `yaml:"critical"`
+	ThresholdDirection string   `yaml:"thresholdDirection"`
+
+	// PublishIfAbove and PublishIfBelow skip publishing the metric unless its value is
+	// above or below them, keeping near-zero noise out of CloudWatch.
+	PublishIfAbove *float64 `yaml:"publishIfAbove"`
+	PublishIfBelow *float64 `yaml:"publishIfBelow"`
+
+	// Description explains the metric to whoever reviews the preview table, and is not published.
+	Description string `yaml:"description"`
+
+	// Enabled set to false skips publishing the metric while keeping its mapping, defaulting to true.
+	Enabled *bool `yaml:"enabled"`
+
+	// passthrough marks a mapping generated for a data key without one, which is
+	// published under the key.
+	passthrough bool
+}
+
+// storageResolution will return the storage resolution of the metric in seconds, falling back
+// to the default storage resolution when the metric does not set highResolution.
+func (c Config) storageResolution(metric MetricMapping) int32 {
+	switch {
+	case metric.HighResolution != nil && *metric.HighResolution:
+		return highStorageResolution
+	case metric.HighResolution == nil && c.DefaultStorageResolution == highStorageResolution:
+		return highStorageResolution
+	}
+	return standardStorageResolution
+}
+
+// namespace will return the namespace for the metric, falling back to the given default.
+func (m MetricMapping) namespace(fallback string) string {
+	if m.Namespace == "" {
+		return fallback
+	}
+	return m.Namespace
+}
+
+// severity will return which of the thresholds of the metric the value has crossed.
+func (m MetricMapping) severity(value MetricValue) string {
+	v, ok := value.average()
+	if !ok {
+		return ""
+	}
+	switch {
+	case m.Critical != nil && m.crosses(v, *m.Critical):
+		return severityCritical
+	case m.Warn != nil && m.crosses(v, *m.Warn):
+		return severityWarn
+	}
+	return ""
+}
+
+// enabled will report whether the metric is published, which it is unless enabled is false.
+func (m MetricMapping) enabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// suppressed will report whether the value fails the publishIfAbove or publishIfBelow condition.
+// Disabled metrics are never suppressed, as they are skipped regardless of their value.
+func (m MetricMapping) suppressed(value MetricValue) bool {
+	v, ok := value.average()
+	if !ok || !m.enabled() {
+		return false
+	}
+	return (m.PublishIfAbove != nil && v <= *m.PublishIfAbove) || (m.PublishIfBelow != nil && v >= *m.PublishIfBelow)
+}
+
+// crosses will report whether the value is past the threshold in the metric's direction.
+func (m MetricMapping) crosses(value, threshold float64) bool {
+	if m.ThresholdDirection == thresholdBelow {
+		return value < threshold
+	}
+	return value > threshold
+}
+
+// unit will return the CloudWatch unit for the metric, defaulting to Count.
+func (m MetricMapping) unit() types.StandardUnit {
+	if m.Unit == "" && m.Type == metricTypePercent {
+		return types.StandardUnitPercent
+	}
+	if m.Unit == "" {
+		return types.StandardUnitCount
+	}
+	return types.StandardUnit(m.Unit)
+}
+
+// MetricMappingDimensions is the definition for the dimensions associated to the metric.
+type MetricMappingDimensions struct {
+	Name          string   `yaml:"name"`
+	Value         string   `yaml:"value"`
+	AllowedValues []string `yaml:"allowedValues"`
+
+	// Sensitive masks the value in the preview table, while still publishing it.
+	Sensitive bool `yaml:"sensitive"`
+}
+
+// ConfigOptions controls how the configuration file is loaded.
+type ConfigOptions struct {
+	// Env selects the environment from the environments of the config, and the
+	// config.<env>.yml overlay to merge over the file.
+	Env string
+
+	// Strict fails on an outdated version or unknown keys, rather than warning about them.
+	Strict bool
+
+	// RequireDimensions fails when a metric ends up with no dimensions, which is usually
+	// a mistake in a shared block such as a YAML anchor.
+	RequireDimensions bool
+}
+
+// LoadConfig will load the configuration file at the given path, merging in the
+// overlay for the environment when one is given.
+func LoadConfig(path string, opts ConfigOptions) (Config, error) {
+	return LoadConfigFiles([]string{path}, MergeError, opts)
+}
+
+// LoadConfigFiles will load each of the config files and merge them into one config, with later
+// files setting fields over earlier ones the way an overlay does. A metric mapping found in more
+// than one file is resolved by the merge strategy. The environment overlay is looked up next to
+// the first file.
+func LoadConfigFiles(paths []string, strategy string, opts ConfigOptions) (Config, error) {
+	var file []byte
+	sources := map[string]string{}
+	for i, path := range paths {
+		next, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return Config{}, ConfigError(fmt.Errorf("config file not found: %s", path))
+		}
+		if err != nil {
+			return Config{}, ConfigError(err)
+		}
+		if len(paths) > 1 {
+			keys, err := metricMappingKeys(next)
+			if err != nil {
+				return Config{}, ConfigError(fmt.Errorf("%s: %w", path, err))
+			}
+			for _, key := range keys {
+				if source, ok := sources[key]; ok && strategy == MergeError {
+					return Config{}, ConfigError(fmt.Errorf("metric mapping %q is in both %s and %s, use --merge-strategy %s to keep the last", key, source, path, MergeLastWins))
+				}
+				sources[key] = path
+			}
+		}
+		if i == 0 {
+			file = next
+			continue
+		}
+		file, err = mergeOverlay(file, next, path)
+		if err != nil {
+			return Config{}, ConfigError(err)
+		}
+	}
+	if opts.Env != "" {
+		var err error
+		file, err = overlayConfig(file, paths[0], opts.Env)
+		if err != nil {
+			return Config{}, ConfigError(err)
+		}
+	}
+	return parseConfig(file, opts)
+}
+
+// metricMappingKeys will return the keys of the metric mappings in the config document.
+func metricMappingKeys(file []byte) ([]string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(file, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	mappings := mappingValue(document.Content[0], "metricMappings")
+	if mappings == nil || mappings.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	var keys []string
+	for i := 0; i+1 < len(mappings.Content); i += 2 {
+		keys = append(keys, mappings.Content[i].Value)
+	}
+	return keys, nil
+}
+
+// parseConfig will decode the configuration document, then resolve, expand and validate it.
+func parseConfig(file []byte, opts ConfigOptions) (Config, error) {
+	var cfg Config
+	err := decodeConfig(file, &cfg, opts.Strict)
+	if err != nil {
+		return cfg, err
+	}
+	err = checkVersion(cfg, opts.Strict)
+	if err != nil {
+		return cfg, err
+	}
+	err = resolveDimensionSets(&cfg)
+	if err != nil {
+		return cfg, ConfigError(err)
+	}
+	err = expandConfig(&cfg)
+	if err != nil {
+		return cfg, ConfigError(err)
+	}
+	err = renderNames(&cfg)
+	if err != nil {
+		return cfg, ConfigError(err)
+	}
+	applyEnvironment(&cfg, opts.Env)
+	err = validateConfig(cfg)
+	if opts.RequireDimensions {
+		err = errors.Join(err, requireDimensions(cfg))
+	}
+	return cfg, ValidationError(err)
+}
+
+// requireDimensions will check every metric has at least one dimension once the defaults,
+// dimension sets and YAML anchors have been resolved.
+func requireDimensions(cfg Config) error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(cfg.MetricMappings)) {
+		if len(cfg.dimensions(cfg.MetricMappings[key])) == 0 {
+			errs = append(errs, fmt.Errorf("metric %q has no dimensions, check any anchor or dimension set it uses", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unknownFieldPattern matches the errors reported for keys which are not config fields.
+var unknownFieldPattern = regexp.MustCompile(`^line (\d+): field (.+) not found in type \S+$`)
+
+// decodeConfig will decode the config file, warning about keys which are not config
+// fields, which are usually typos, or failing on them when strict.
+func decodeConfig(file []byte, cfg *Config, strict bool) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(file))
+	decoder.KnownFields(true)
+	err := decoder.Decode(cfg)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return ConfigError(err)
+	}
+
+	// Unknown keys are reported alongside any other type errors, and do not stop the
+	// rest of the file from being decoded.
+	var unknown, invalid []string
+	for _, message := range typeErr.Errors {
+		if match := unknownFieldPattern.FindStringSubmatch(message); match != nil {
+			// Keys such as x-dimensions are left for holding YAML anchors.
+			if strings.HasPrefix(match[2], extensionKeyPrefix) {
+				continue
+			}
+			unknown = append(unknown, fmt.Sprintf("%s (line %s)", match[2], match[1]))
+			continue
+		}
+		invalid = append(invalid, message)
+	}
+	if len(invalid) > 0 {
+		return ConfigError(&yaml.TypeError{Errors: invalid})
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if strict {
+		return ConfigError(fmt.Errorf("config has unknown keys: %s", strings.Join(unknown, ", ")))
+	}
+	LogWarn(fmt.Sprintf("The config has unknown keys which are ignored: %s", strings.Join(unknown, ", ")), "keys", unknown)
+	return nil
+}
+
+// checkVersion will warn when the config is older than the current version, explaining
+// what changed since, or fail when strict. Configs newer than the current version are
+// always rejected, as they may rely on behaviour this version does not have.
+func checkVersion(cfg Config, strict bool) error {
+	if cfg.Version > currentConfigVersion {
+		return ConfigError(fmt.Errorf("config version %d is newer than the supported version %d, upgrade to use it", cfg.Version, currentConfigVersion))
+	}
+	if cfg.Version == currentConfigVersion {
+		return nil
+	}
+
+	var changes []string
+	for version := cfg.Version + 1; version <= currentConfigVersion; version++ {
+		changes = append(changes, fmt.Sprintf("version %d: %s", version, configChanges[version]))
+	}
+	msg := fmt.Sprintf("config version %d is older than the current version %d, review the changes and set version: %d (%s)", cfg.Version, currentConfigVersion, currentConfigVersion, strings.Join(changes, "; "))
+	if strict {
+		return ConfigError(errors.New(msg))
+	}
+	LogWarn(strings.ToUpper(msg[:1])+msg[1:], "version", cfg.Version, "currentVersion", currentConfigVersion)
+	return nil
+}
+
+// overlayConfig will merge the environment's overlay file, such as config.prod.yml
+// for config.yml, on top of the base config and return the merged document.
+func overlayConfig(base []byte, path, env string) ([]byte, error) {
+	ext := filepath.Ext(path)
+	overlayPath := strings.TrimSuffix(path, ext) + "." + env + ext
+	overlay, err := os.ReadFile(overlayPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if definesEnvironment(base, env) {
+			return base, nil
+		}
+		return nil, fmt.Errorf("environment %q is not in the environments of the config, and its config overlay was not found: %s", env, overlayPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mergeOverlay(base, overlay, overlayPath)
+}
+
+// mergeOverlay will merge the overlay document on top of the base document and return
+// the merged document, naming the overlay in any error about it.
+func mergeOverlay(base, overlay []byte, overlayPath string) ([]byte, error) {
+	var baseDoc, overlayDoc yaml.Node
+	if err := yaml.Unmarshal(base, &baseDoc); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(overlay, &overlayDoc); err != nil {
+		return nil, fmt.Errorf("%s: %w", overlayPath, err)
+	}
+	baseRoot, err := documentMapping(&baseDoc)
+	if err != nil {
+		return nil, err
+	}
+	overlayRoot, err := documentMapping(&overlayDoc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", overlayPath, err)
+	}
+
+	mergeNodes(baseRoot, overlayRoot)
+	return yaml.Marshal(&baseDoc)
+}
+
+// mergeNodes will merge the overlay mapping into the base mapping key by key, with the
+// overlay winning. Nested mappings are merged, while any other value is replaced.
+func mergeNodes(base, overlay *yaml.Node) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		existing := mappingValue(base, key.Value)
+		switch {
+		case existing == nil:
+			base.Content = append(base.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeNodes(existing, value)
+		default:
+			*existing = *value
+		}
+	}
+}
+
+// resolveDimensionSets will replace each metric's dimension set reference with the
+// dimensions of that set, merging the metric's own dimensions on top.
+func resolveDimensionSets(cfg *Config) error {
+	var errs []error
+	for key, metric := range cfg.MetricMappings {
+		if metric.DimensionSet == "" {
+			continue
+		}
+		set, ok := cfg.DimensionSets[metric.DimensionSet]
+		if !ok {
+			errs = append(errs, fmt.Errorf("metric %q references unknown dimension set %q", key, metric.DimensionSet))
+			continue
+		}
+		metric.Dimensions = mergeDimensions(set, metric.Dimensions)
+		cfg.MetricMappings[key] = metric
+	}
+	slices.SortFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+	return errors.Join(errs...)
+}
+
+// metricNameData is what a metric name template can refer to.
+type metricNameData struct {
+	Key string
+}
+
+// renderNames will render each metric name as a template of its data key, so a name such
+// as app_{{.Key}} need not repeat the key. Metrics without a name are named after the key.
+func renderNames(cfg *Config) error {
+	var errs []error
+	for key, metric := range cfg.MetricMappings {
+		switch {
+		case metric.Name == "":
+			metric.Name = key
+		case strings.Contains(metric.Name, "{{"):
+			var name strings.Builder
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(metric.Name)
+			if err == nil {
+				err = tmpl.Execute(&name, metricNameData{Key: key})
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("metric %q name template %q: %w", key, metric.Name, err))
+				continue
+			}
+			metric.Name = name.String()
+		default:
+			continue
+		}
+		cfg.MetricMappings[key] = metric
+	}
+	slices.SortFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+	return errors.Join(errs...)
+}
+
+// expandConfig will resolve environment variable references in the dimensions.
+func expandConfig(cfg *Config) error {
+	var errs []error
+	var err error
+
+	cfg.DefaultDimensions, err = expandDimensions(cfg.DefaultDimensions)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("default dimensions: %w", err))
+	}
+
+	for key, metric := range cfg.MetricMappings {
+		metric.Dimensions, err = expandDimensions(metric.Dimensions)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("metric %q: %w", key, err))
+		}
+		cfg.MetricMappings[key] = metric
+	}
+	return errors.Join(errs...)
+}
+
+// expandDimensions will replace ${VAR} and $VAR references in the dimension names
+// and values, returning an error naming any variables which are not set.
+func expandDimensions(dimensions []MetricMappingDimensions) ([]MetricMappingDimensions, error) {
+	var missing []string
+	lookup := func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return value
+	}
+
+	expanded := make([]MetricMappingDimensions, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		dimension.Name = os.Expand(dimension.Name, lookup)
+		dimension.Value = os.Expand(dimension.Value, lookup)
+		expanded = append(expanded, dimension)
+	}
+
+	if len(missing) > 0 {
+		return expanded, fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// validateConfig will check the configuration for values CloudWatch would reject.
+func validateConfig(cfg Config) error {
+	var errs []error
+	if cfg.MetricNamespace != "" {
+		errs = append(errs, ValidateNamespace("metricNamespace", cfg.MetricNamespace))
+	}
+	if cfg.MetaNamespace != "" {
+		errs = append(errs, ValidateNamespace("metaNamespace", cfg.MetaNamespace))
+	}
+	for _, dimension := range cfg.DefaultDimensions {
+		errs = append(errs, ValidateDimension("defaultDimensions", cfg.prefixDimension(dimension)))
+	}
+	if len(cfg.DefaultDimensions) > maxDimensionsPerMetric {
+		errs = append(errs, fmt.Errorf("defaultDimensions has %d dimensions, the maximum is %d", len(cfg.DefaultDimensions), maxDimensionsPerMetric))
+	}
+	switch cfg.DefaultStorageResolution {
+	case 0, highStorageResolution, standardStorageResolution:
+	default:
+		errs = append(errs, fmt.Errorf("defaultStorageResolution %d is not supported, it must be %d or %d", cfg.DefaultStorageResolution, highStorageResolution, standardStorageResolution))
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(cfg.DerivedMetrics)) {
+		if _, err := parseDerivedExpression(cfg.DerivedMetrics[key]); err != nil {
+			errs = append(errs, fmt.Errorf("derived metric %q: %w", key, err))
+		}
+	}
+
+	keys := make([]string, 0, len(cfg.MetricMappings))
+	for key := range cfg.MetricMappings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		metric := cfg.MetricMappings[key]
+		if metric.Unit != "" && !slices.Contains(types.StandardUnit("").Values(), types.StandardUnit(metric.Unit)) {
+			errs = append(errs, fmt.Errorf("metric %q has unknown unit %q", key, metric.Unit))
+		}
+		if metric.Type != "" && metric.Type != metricTypePercent {
+			errs = append(errs, fmt.Errorf("metric %q has unknown type %q", key, metric.Type))
+		}
+		errs = append(errs, validateThresholds(key, metric))
+		if metric.PublishIfAbove != nil && metric.PublishIfBelow != nil && *metric.PublishIfAbove >= *metric.PublishIfBelow {
+			errs = append(errs, fmt.Errorf("metric %q publishIfAbove %g is not less than publishIfBelow %g, so it would never be published", key, *metric.PublishIfAbove, *metric.PublishIfBelow))
+		}
+		errs = append(errs, validateName(fmt.Sprintf("metric %q name", key), metric.Name, maxNameLength))
+		if metric.Namespace != "" {
+			errs = append(errs, ValidateNamespace(fmt.Sprintf("metric %q namespace", key), metric.Namespace))
+		}
+		for _, dimension := range metric.Dimensions {
+			dimension.AllowedValues = allowedValues(cfg, dimension)
+			errs = append(errs, ValidateDimension(fmt.Sprintf("metric %q", key), cfg.prefixDimension(dimension)))
+		}
+		// The defaults alone are reported above, so only metrics adding to them are reported here.
+		if n := len(cfg.dimensions(metric)); n > maxDimensionsPerMetric && len(metric.Dimensions) > 0 {
+			errs = append(errs, fmt.Errorf("metric %q has %d dimensions including the default dimensions, the maximum is %d", key, n, maxDimensionsPerMetric))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateNamespace will check a namespace against the CloudWatch length and character constraints.
+func ValidateNamespace(field, namespace string) error {
+	if err := validateName(field, namespace, maxNameLength); err != nil {
+		return err
+	}
+	if strings.HasPrefix(namespace, "AWS/") {
+		return fmt.Errorf("%s %q must not start with the reserved prefix \"AWS/\"", field, namespace)
+	}
+	for _, r := range namespace {
+		if !strings.ContainsRune(namespaceCharacters, r) {
+			return fmt.Errorf("%s %q contains the invalid character %q", field, namespace, r)
+		}
+	}
+	return nil
+}
+
+// validateThresholds will check the threshold direction is known, and that the critical
+// threshold is no less severe than the warning threshold.
+func validateThresholds(key string, metric MetricMapping) error {
+	switch metric.ThresholdDirection {
+	case "", thresholdAbove, thresholdBelow:
+	default:
+		return fmt.Errorf("metric %q has unknown thresholdDirection %q, expected %s or %s", key, metric.ThresholdDirection, thresholdAbove, thresholdBelow)
+	}
+	if metric.Warn != nil && metric.Critical != nil && metric.crosses(*metric.Warn, *metric.Critical) {
+		return fmt.Errorf("metric %q critical threshold %g is less severe than the warn threshold %g", key, *metric.Critical, *metric.Warn)
+	}
+	return nil
+}
+
+// allowedValues will return the values allowed for a metric's dimension, inheriting
+// those of the default dimension it overrides when it has none of its own.
+func allowedValues(cfg Config, dimension MetricMappingDimensions) []string {
+	if len(dimension.AllowedValues) > 0 {
+		return dimension.AllowedValues
+	}
+	for _, d := range cfg.DefaultDimensions {
+		if d.Name == dimension.Name {
+			return d.AllowedValues
+		}
+	}
+	return nil
+}
+
+// ValidateDimension will check a dimension name and value against the CloudWatch constraints
+// and, when it has any, the allowed values.
+func ValidateDimension(field string, dimension MetricMappingDimensions) error {
+	err := validateName(field+" dimension name", dimension.Name, maxNameLength)
+	if err == nil && strings.HasPrefix(dimension.Name, ":") {
+		err = fmt.Errorf("%s dimension name %q must not start with a colon", field, dimension.Name)
+	}
+	if len(dimension.AllowedValues) > 0 && !slices.Contains(dimension.AllowedValues, dimension.Value) {
+		err = errors.Join(err, fmt.Errorf("%s dimension %q value %q is not one of the allowed values: %s", field, dimension.Name, dimension.Value, strings.Join(dimension.AllowedValues, ", ")))
+	}
+	return errors.Join(err, validateName(fmt.Sprintf("%s dimension %q value", field, dimension.Name), dimension.Value, maxDimensionValueLength))
+}
+
+// validateName will check that a name is non-blank printable ASCII no longer than the given length.
+func validateName(field, name string, length int) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%s must not be empty", field)
+	}
+	if len(name) > length {
+		return fmt.Errorf("%s %q is %d characters long, the maximum is %d", field, name, len(name), length)
+	}
+	for _, r := range name {
+		if r < ' ' || r > '~' {
+			return fmt.Errorf("%s %q contains the invalid character %q", field, name, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,898 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PerformanceData is the data being captured and sent to AWS.
+type PerformanceData map[string]MetricValue
+
+// keys will return the data keys in sorted order.
+func (d PerformanceData) keys() []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricValue is a single data point, which is written either as a plain number
+// or as a mapping with a value or pre-aggregated statistics and an optional
+// timestamp, either RFC3339 or Unix epoch seconds or milliseconds.
+type MetricValue struct {
+	Value      float64
+	Statistics *StatisticSet
+	Timestamp  *time.Time
+}
+
+// StatisticSet is a set of pre-aggregated values for a metric.
+type StatisticSet struct {
+	SampleCount float64
+	Sum         float64
+	Minimum     float64
+	Maximum     float64
+}
+
+// metricValueFields is the mapping form of a MetricValue.
+type metricValueFields struct {
+	Value       *float64       `yaml:"value,omitempty" json:"value"`
+	SampleCount *float64       `yaml:"sampleCount,omitempty" json:"sampleCount"`
+	Sum         *float64       `yaml:"sum,omitempty" json:"sum"`
+	Minimum     *float64       `yaml:"minimum,omitempty" json:"minimum"`
+	Maximum     *float64       `yaml:"maximum,omitempty" json:"maximum"`
+	Timestamp   timestampField `yaml:"timestamp,omitempty" json:"timestamp"`
+}
+
+// timestampField is a timestamp as written in the data, either an RFC3339 string or a number.
+type timestampField string
+
+// UnmarshalYAML will accept the timestamp as any scalar, keeping it as written.
+func (t *timestampField) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: timestamp must be an RFC3339 string or epoch number", node.Line)
+	}
+	*t = timestampField(node.Value)
+	return nil
+}
+
+// UnmarshalJSON will accept the timestamp as either a string or a number.
+func (t *timestampField) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(b, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*t = timestampField(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("timestamp must be an RFC3339 string or epoch number: %w", err)
+	}
+	*t = timestampField(n)
+	return nil
+}
+
+// UnmarshalYAML will decode a MetricValue from either a number or a mapping.
+func (m *MetricValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.Value)
+	}
+	var fields metricValueFields
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+	return m.setFields(fields)
+}
+
+// MarshalYAML will encode a MetricValue as a number, or as a mapping when it has statistics
+// or a timestamp, in the form UnmarshalYAML reads.
+func (m MetricValue) MarshalYAML() (any, error) {
+	if m.Statistics == nil && m.Timestamp == nil {
+		return m.Value, nil
+	}
+	var fields metricValueFields
+	if m.Statistics != nil {
+		fields.SampleCount = &m.Statistics.SampleCount
+		fields.Sum = &m.Statistics.Sum
+		fields.Minimum = &m.Statistics.Minimum
+		fields.Maximum = &m.Statistics.Maximum
+	} else {
+		fields.Value = &m.Value
+	}
+	if m.Timestamp != nil {
+		fields.Timestamp = timestampField(m.Timestamp.Format(time.RFC3339Nano))
+	}
+	return fields, nil
+}
+
+// UnmarshalJSON will decode a MetricValue from either a number or an object.
+func (m *MetricValue) UnmarshalJSON(b []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return json.Unmarshal(b, &m.Value)
+	}
+	var fields metricValueFields
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	return m.setFields(fields)
+}
+
+// setFields will populate the MetricValue from its mapping form.
+func (m *MetricValue) setFields(fields metricValueFields) error {
+	statistics := []*float64{fields.SampleCount, fields.Sum, fields.Minimum, fields.Maximum}
+	hasStatistics := slices.ContainsFunc(statistics, func(v *float64) bool { return v != nil })
+
+	switch {
+	case fields.Value != nil && hasStatistics:
+		return fmt.Errorf("metric value and statistics are mutually exclusive")
+	case fields.Value != nil:
+		m.Value = *fields.Value
+	case hasStatistics:
+		if slices.Contains(statistics, nil) {
+			return fmt.Errorf("metric statistics require sampleCount, sum, minimum and maximum")
+		}
+		m.Statistics = &StatisticSet{
+			SampleCount: *fields.SampleCount,
+			Sum:         *fields.Sum,
+			Minimum:     *fields.Minimum,
+			Maximum:     *fields.Maximum,
+		}
+	default:
+		return fmt.Errorf("metric value or statistics are required")
+	}
+
+	if fields.Timestamp != "" {
+		timestamp, err := parseTimestamp(string(fields.Timestamp))
+		if err != nil {
+			return err
+		}
+		m.Timestamp = &timestamp
+	}
+	return nil
+}
+
+// parseTimestamp will parse an RFC3339 timestamp, or a Unix epoch in seconds or milliseconds
+// told apart by magnitude. Epochs which could be either, or neither, are rejected.
+func parseTimestamp(s string) (time.Time, error) {
+	epoch, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		timestamp, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC3339 or epoch seconds or milliseconds: %w", s, err)
+		}
+		return timestamp, nil
+	}
+
+	switch {
+	case math.IsNaN(epoch) || epoch < 0:
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, epoch timestamps must not be negative", s)
+	case epoch < maxEpochSeconds:
+		sec, frac := math.Modf(epoch)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	case epoch < minEpochMilliseconds:
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, too large for epoch seconds and too small for epoch milliseconds", s)
+	case epoch < maxEpochMilliseconds:
+		return time.UnixMilli(int64(epoch)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, out of range for epoch milliseconds", s)
+}
+
+// transform will apply the scale and offset of the mapping to the value, leaving
+// the sample count of statistics untouched.
+func (m MetricValue) transform(mapping MetricMapping) MetricValue {
+	scale := 1.0
+	if mapping.Scale != nil {
+		scale = *mapping.Scale
+	}
+	if scale == 1 && mapping.Offset == 0 {
+		return m
+	}
+
+	apply := func(v float64) float64 {
+		return v*scale + mapping.Offset
+	}
+	if m.Statistics == nil {
+		m.Value = apply(m.Value)
+		return m
+	}
+
+	stats := *m.Statistics
+	stats.Sum = stats.Sum*scale + mapping.Offset*stats.SampleCount
+	stats.Minimum = apply(m.Statistics.Minimum)
+	stats.Maximum = apply(m.Statistics.Maximum)
+	if scale < 0 {
+		stats.Minimum, stats.Maximum = stats.Maximum, stats.Minimum
+	}
+	m.Statistics = &stats
+	return m
+}
+
+// within will report whether the value, or the minimum and maximum of the statistics, are in the range.
+func (m MetricValue) within(low, high float64) bool {
+	if m.Statistics == nil {
+		return m.Value >= low && m.Value <= high
+	}
+	return m.Statistics.Minimum >= low && m.Statistics.Maximum <= high
+}
+
+// average will return the value, or the average of the statistics, reporting false
+// for statistics without any samples.
+func (m MetricValue) average() (float64, bool) {
+	if m.Statistics == nil {
+		return m.Value, true
+	}
+	if m.Statistics.SampleCount == 0 {
+		return 0, false
+	}
+	return m.Statistics.Sum / m.Statistics.SampleCount, true
+}
+
+// finite will report whether the value, or every value of the statistics, is neither NaN nor infinite.
+func (m MetricValue) finite() bool {
+	values := []float64{m.Value}
+	if m.Statistics != nil {
+		values = []float64{m.Statistics.SampleCount, m.Statistics.Sum, m.Statistics.Minimum, m.Statistics.Maximum}
+	}
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// clamp will limit the value, or the minimum and maximum of the statistics, to the range.
+func (m MetricValue) clamp(low, high float64) MetricValue {
+	if m.Statistics == nil {
+		m.Value = min(max(m.Value, low), high)
+		return m
+	}
+	stats := *m.Statistics
+	stats.Minimum = min(max(stats.Minimum, low), high)
+	stats.Maximum = min(max(stats.Maximum, low), high)
+	m.Statistics = &stats
+	return m
+}
+
+// display will format the value or statistics for the preview table.
+func (m MetricValue) display(precision int) string {
+	if m.Statistics == nil {
+		return fmt.Sprint(roundValue(m.Value, precision))
+	}
+	return fmt.Sprintf("count=%v sum=%v min=%v max=%v",
+		m.Statistics.SampleCount,
+		roundValue(m.Statistics.Sum, precision),
+		roundValue(m.Statistics.Minimum, precision),
+		roundValue(m.Statistics.Maximum, precision),
+	)
+}
+
+// sameValue will report whether the values, or statistic sets, are equal.
+func (m MetricValue) sameValue(other MetricValue) bool {
+	if m.Statistics == nil || other.Statistics == nil {
+		return m.Statistics == other.Statistics && m.Value == other.Value
+	}
+	return *m.Statistics == *other.Statistics
+}
+
+// timestamp will return the timestamp of the value, falling back to the given time.
+func (m MetricValue) timestamp(fallback time.Time) time.Time {
+	if m.Timestamp == nil {
+		return fallback
+	}
+	return *m.Timestamp
+}
+
+// DataOptions controls how data files are decoded.
+type DataOptions struct {
+	// Format is one of DataFormatYAML, DataFormatJSON or DataFormatCSV, or empty to detect it.
+	Format string
+
+	// KeySeparator joins the keys of nested data into a single data key, defaulting to a dot.
+	KeySeparator string
+
+	// Timeout limits fetching the data from a URL, defaulting to defaultFetchTimeout.
+	Timeout time.Duration
+}
+
+// keySeparator will return the separator for the keys of nested data.
+func (o DataOptions) keySeparator() string {
+	if o.KeySeparator == "" {
+		return defaultKeySeparator
+	}
+	return o.KeySeparator
+}
+
+// timeout will return the timeout for fetching the data from a URL.
+func (o DataOptions) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return defaultFetchTimeout
+	}
+	return o.Timeout
+}
+
+// LoadDataFiles will load each of the data files and merge them into one set of data,
+// resolving keys found in more than one file by the merge strategy.
+func LoadDataFiles(paths []string, strategy string, opts DataOptions) (PerformanceData, error) {
+	merged := PerformanceData{}
+	sources := map[string]string{}
+	for _, path := range paths {
+		data, err := LoadData(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range data.keys() {
+			if source, ok := sources[key]; ok && strategy == MergeError {
+				return nil, ValidationError(fmt.Errorf("data key %q is in both %s and %s, use --merge-strategy %s to keep the last", key, source, path, MergeLastWins))
+			}
+			merged[key] = data[key]
+			sources[key] = path
+		}
+	}
+	return merged, nil
+}
+
+// LoadData will load the data file at the given path, from stdin when the path is "-", or
+// from the URL when the path is one.
+func LoadData(path string, opts DataOptions) (PerformanceData, error) {
+	data, err := ReadData(path, opts)
+	if err != nil {
+		return data, err
+	}
+	return data, ValidationError(validateData(data))
+}
+
+// ReadData will read and decode the data file at the given path without validating it.
+// The format is detected from the extension, the Content-Type of a URL, or the content,
+// unless one is given.
+func ReadData(path string, opts DataOptions) (PerformanceData, error) {
+	var file []byte
+	// name is what the format is detected from, the path or the path of the URL.
+	var name string
+	var err error
+	switch {
+	case IsStdin(path):
+		file, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, ConfigError(fmt.Errorf("unable to read data from stdin: %w", err))
+		}
+	case IsURL(path):
+		file, name, err = fetchData(path, opts.timeout())
+		if err != nil {
+			return nil, ConfigError(err)
+		}
+	default:
+		file, err = os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ConfigError(fmt.Errorf("data file not found: %s", path))
+		}
+		if err != nil {
+			return nil, ConfigError(err)
+		}
+		name = path
+	}
+	ext := filepath.Ext(name)
+
+	// Compressed files are decoded by the extension of the name inside, such as data.yml.gz.
+	if strings.EqualFold(ext, ".gz") || bytes.HasPrefix(file, gzipMagic) {
+		file, err = gunzip(file)
+		if err != nil {
+			return nil, ConfigError(fmt.Errorf("unable to decompress data file %s: %w", path, err))
+		}
+		if strings.EqualFold(ext, ".gz") {
+			ext = filepath.Ext(strings.TrimSuffix(name, ext))
+		}
+	}
+
+	data, err := decodeData(file, ext, opts)
+	return data, ConfigError(err)
+}
+
+// IsURL will report whether the data path is an HTTP or HTTPS URL to fetch the data from.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchData will fetch the data from the URL, returning the body along with the name to detect
+// its format from. The name is the path of the URL, with an extension from the Content-Type
+// added when the path has none.
+func fetchData(rawURL string, timeout time.Duration) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid data URL %s: %w", rawURL, err)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to fetch data from %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("fetching data from %s returned %s", rawURL, resp.Status)
+		// Error pages are left out, as they are rarely readable in a terminal.
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if text := strings.TrimSpace(string(message)); text != "" && mediaType != "text/html" {
+			err = fmt.Errorf("%w: %s", err, text)
+		}
+		return nil, "", err
+	}
+	file, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read data from %s: %w", rawURL, err)
+	}
+
+	name := u.Path
+	if filepath.Ext(name) == "" {
+		name += contentTypeExtensions[mediaType]
+	}
+	return file, name, nil
+}
+
+// contentTypeExtensions maps the Content-Type of fetched data to the extension of its format.
+var contentTypeExtensions = map[string]string{
+	"application/json":   ".json",
+	"application/yaml":   ".yml",
+	"application/x-yaml": ".yml",
+	"text/yaml":          ".yml",
+	"text/x-yaml":        ".yml",
+	"text/csv":           ".csv",
+	"application/gzip":   ".gz",
+}
+
+// gunzip will decompress the gzipped data.
+func gunzip(file []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// validateData will check the data for values CloudWatch would reject.
+func validateData(data PerformanceData) error {
+	var errs []error
+	oldest := time.Now().Add(-MaxMetricAge)
+	for _, key := range data.keys() {
+		value := data[key]
+		if value.Timestamp != nil && value.Timestamp.Before(oldest) {
+			errs = append(errs, fmt.Errorf("metric %q has timestamp %s which is older than the two week limit", key, value.Timestamp.Format(time.RFC3339)))
+		}
+		if stats := value.Statistics; stats != nil {
+			if stats.SampleCount <= 0 {
+				errs = append(errs, fmt.Errorf("metric %q must have a sampleCount greater than zero", key))
+			}
+			if stats.Minimum > stats.Maximum {
+				errs = append(errs, fmt.Errorf("metric %q has a minimum greater than its maximum", key))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FilterData will restrict the data to the given keys, warning about any which are not present.
+func FilterData(data PerformanceData, keys []string) PerformanceData {
+	filtered := make(PerformanceData, len(keys))
+	for _, key := range keys {
+		value, ok := data[key]
+		if !ok {
+			LogWarn(fmt.Sprintf("Metric %q was requested but is not in the data", key), "key", key)
+			continue
+		}
+		filtered[key] = value
+	}
+	return filtered
+}
+
+// CheckMetrics will check the data against the metric mappings for values CloudWatch would reject.
+// The dimensions are counted again here, as the runtime dimension is added after the config is
+// validated.
+func CheckMetrics(data PerformanceData, config Config) []error {
+	var errs []error
+	oldest := time.Now().Add(-maxHighResolutionAge)
+	for _, key := range data.keys() {
+		metric, ok := config.MetricMappings[key]
+		if !ok || !metric.enabled() {
+			continue
+		}
+		value := data[key]
+		if n := len(config.dimensions(metric)); n > maxDimensionsPerMetric {
+			errs = append(errs, fmt.Errorf("metric %q has %d dimensions including the default and runtime dimensions, the maximum is %d", key, n, maxDimensionsPerMetric))
+		}
+		if config.storageResolution(metric) == highStorageResolution && value.Timestamp != nil && value.Timestamp.Before(oldest) {
+			errs = append(errs, fmt.Errorf("high resolution metric %q has timestamp %s which is older than the three hour limit", key, value.Timestamp.Format(time.RFC3339)))
+		}
+		if metric.Type == metricTypePercent && !value.within(0, 100) {
+			errs = append(errs, fmt.Errorf("percent metric %q has value %s outside of 0-100, use --clamp to clamp it", key, value.display(config.precision())))
+		}
+	}
+	return errs
+}
+
+// ScaleData will apply the scale and offset of each metric mapping to the data.
+func ScaleData(data PerformanceData, config Config) PerformanceData {
+	scaled := make(PerformanceData, len(data))
+	for key, value := range data {
+		if metric, ok := config.MetricMappings[key]; ok {
+			value = value.transform(metric)
+		}
+		scaled[key] = value
+	}
+	return scaled
+}
+
+// ClampPercentages will clamp the values of percent metrics into the range 0-100.
+func ClampPercentages(data PerformanceData, config Config) PerformanceData {
+	clamped := make(PerformanceData, len(data))
+	for key, value := range data {
+		if config.MetricMappings[key].Type == metricTypePercent {
+			value = value.clamp(0, 100)
+		}
+		clamped[key] = value
+	}
+	return clamped
+}
+
+// IsStdin will report whether the data path refers to stdin. Kingpin parses a
+// bare "-" argument as an empty value, so both are accepted.
+func IsStdin(path string) bool {
+	return path == stdinDataFile || path == ""
+}
+
+// decodeData will unmarshal the data based on the file extension, trying both
+// YAML and JSON when the extension is not recognised.
+func decodeData(file []byte, ext string, opts DataOptions) (PerformanceData, error) {
+	var data PerformanceData
+	if len(bytes.TrimSpace(file)) == 0 {
+		return data, nil
+	}
+
+	separator := opts.keySeparator()
+	switch opts.Format {
+	case DataFormatJSON:
+		data, err := decodeJSON(file, separator)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode data as JSON: %w", err)
+		}
+		return data, nil
+	case DataFormatYAML:
+		data, err := decodeYAML(file, separator)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode data as YAML: %w", err)
+		}
+		return data, nil
+	case DataFormatCSV:
+		data, err := decodeCSV(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode data as CSV: %w", err)
+		}
+		return data, nil
+	}
+
+	switch strings.ToLower(ext) {
+	case ".json":
+		return decodeJSON(file, separator)
+	case ".yml", ".yaml":
+		return decodeYAML(file, separator)
+	case ".csv":
+		return decodeCSV(file)
+	}
+
+	data, yamlErr := decodeYAML(file, separator)
+	if yamlErr == nil {
+		return data, nil
+	}
+	data, jsonErr := decodeJSON(file, separator)
+	if jsonErr == nil {
+		return data, nil
+	}
+	return nil, fmt.Errorf("unable to decode data as YAML (%v) or JSON (%v)", yamlErr, jsonErr)
+}
+
+// metricValueKeys are the keys of the mapping form of a metric value, which tell it apart
+// from a group of nested metrics.
+var metricValueKeys = []string{"value", "sampleCount", "sum", "minimum", "maximum", "timestamp"}
+
+// decodeYAML will decode YAML data, flattening nested groups of metrics into keys joined
+// by the separator, so frontend: {latency: 12} becomes frontend.latency.
+func decodeYAML(file []byte, separator string) (PerformanceData, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(file, &document); err != nil {
+		return nil, err
+	}
+	data := PerformanceData{}
+	if len(document.Content) == 0 {
+		return data, nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: data must be a mapping of keys to metric values", root.Line)
+	}
+	return data, flattenYAML(root, "", separator, data)
+}
+
+// flattenYAML will add the metrics of the mapping to the data, recursing into nested groups.
+func flattenYAML(node *yaml.Node, prefix, separator string, data PerformanceData) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+		key := prefix + keyNode.Value
+
+		if value.Kind == yaml.MappingNode && isGroup(yamlKeys(value)) {
+			if err := flattenYAML(value, key+separator, separator, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := data[key]; ok {
+			return fmt.Errorf("line %d: data key %q is given more than once", keyNode.Line, key)
+		}
+		var metric MetricValue
+		if err := value.Decode(&metric); err != nil {
+			return fmt.Errorf("data key %q: %w", key, err)
+		}
+		data[key] = metric
+	}
+	return nil
+}
+
+// yamlKeys will return the keys of the mapping node.
+func yamlKeys(node *yaml.Node) []string {
+	var keys []string
+	for i := 0; i < len(node.Content); i += 2 {
+		keys = append(keys, node.Content[i].Value)
+	}
+	return keys
+}
+
+// decodeJSON will decode JSON data, flattening nested groups of metrics into keys joined
+// by the separator, in the same way as decodeYAML.
+func decodeJSON(file []byte, separator string) (PerformanceData, error) {
+	data := PerformanceData{}
+	return data, flattenJSON(file, "", separator, data)
+}
+
+// flattenJSON will add the metrics of the object to the data, recursing into nested groups.
+func flattenJSON(object []byte, prefix, separator string, data PerformanceData) error {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(object, &entries); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		value := entries[name]
+		key := prefix + name
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(value, &fields) == nil && isGroup(slices.Collect(maps.Keys(fields))) {
+			if err := flattenJSON(value, key+separator, separator, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := data[key]; ok {
+			return fmt.Errorf("data key %q is given more than once", key)
+		}
+		var metric MetricValue
+		if err := json.Unmarshal(value, &metric); err != nil {
+			return fmt.Errorf("data key %q: %w", key, err)
+		}
+		data[key] = metric
+	}
+	return nil
+}
+
+// isGroup will report whether a mapping with the given keys is a group of nested metrics,
+// rather than the mapping form of a single metric value.
+func isGroup(keys []string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	return !slices.ContainsFunc(keys, func(key string) bool {
+		return slices.Contains(metricValueKeys, key)
+	})
+}
+
+// decodeCSV will parse two-column metric,value rows, skipping a header row if present.
+func decodeCSV(file []byte) (PerformanceData, error) {
+	reader := csv.NewReader(bytes.NewReader(file))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	data := make(PerformanceData)
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) != 2 {
+			return nil, fmt.Errorf("line %d: expected 2 columns, found %d", line, len(record))
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			if row == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid value %q for metric %q", line, record[1], record[0])
+		}
+		data[strings.TrimSpace(record[0])] = MetricValue{Value: value}
+	}
+}
+
+// roundValue will round the value to the given number of decimal places, leaving
+// it untouched when the precision is negative.
+func roundValue(v float64, precision int) float64 {
+	if precision < 0 {
+		return v
+	}
+	scale := math.Pow10(precision)
+	return math.Round(v*scale) / scale
+}
+
+// UnmappedKeys will return the sorted data keys which have no metric mapping.
+func UnmappedKeys(data PerformanceData, config Config) []string {
+	var keys []string
+	for _, key := range data.keys() {
+		if _, ok := config.MetricMappings[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// AddPassthroughMappings will add a mapping for each data key and derived metric without one,
+// publishing it under the key with only the default dimensions. The mappings of the config
+// are copied first, so other copies of the config are left as they were.
+func AddPassthroughMappings(cfg *Config, data PerformanceData) error {
+	keys := slices.Concat(UnmappedKeys(data, *cfg), slices.Sorted(maps.Keys(cfg.DerivedMetrics)))
+	mappings := maps.Clone(cfg.MetricMappings)
+	if mappings == nil {
+		mappings = make(map[string]MetricMapping, len(keys))
+	}
+
+	var errs []error
+	for _, key := range keys {
+		if _, ok := mappings[key]; ok {
+			continue
+		}
+		if err := validateName(fmt.Sprintf("passthrough metric %q name", key), key, maxNameLength); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		metric := MetricMapping{Name: key, Unit: cfg.unitOverride, passthrough: true}
+		if unit, ok := inferUnit(key); ok && cfg.inferUnits && metric.Unit == "" {
+			metric.Unit = string(unit)
+		}
+		mappings[key] = metric
+	}
+	cfg.MetricMappings = mappings
+	return errors.Join(errs...)
+}
+
+// nonFiniteKeys will return the sorted mapped data keys of enabled metrics with a NaN or
+// infinite value, which CloudWatch would reject along with the rest of their batch.
+func nonFiniteKeys(data PerformanceData, config Config) []string {
+	var keys []string
+	for _, key := range data.keys() {
+		if metric, ok := config.MetricMappings[key]; ok && metric.enabled() && !data[key].finite() {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// disabledKeys will return the sorted mapped data keys whose metric is disabled.
+func disabledKeys(data PerformanceData, config Config) []string {
+	var keys []string
+	for _, key := range data.keys() {
+		if metric, ok := config.MetricMappings[key]; ok && !metric.enabled() {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// suppressedKeys will return the sorted mapped data keys whose value fails the metric's
+// publishIfAbove or publishIfBelow condition.
+func suppressedKeys(data PerformanceData, config Config) []string {
+	var keys []string
+	for _, key := range data.keys() {
+		if metric, ok := config.MetricMappings[key]; ok && metric.suppressed(data[key]) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// withoutKeys will return a copy of the data without the given keys.
+func withoutKeys(data PerformanceData, keys []string) PerformanceData {
+	filtered := make(PerformanceData, len(data))
+	for key, value := range data {
+		if !slices.Contains(keys, key) {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// gzipMagic is the header which starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// DedupeData will collapse data keys which map to the same metric, with the same dimensions
+// and timestamp, into the first of them, so identical datums are not sent twice.
+func DedupeData(data PerformanceData, config Config) PerformanceData {
+	deduped := make(PerformanceData, len(data))
+	seen := make(map[string]string)
+	for _, key := range data.keys() {
+		value := data[key]
+		// A disabled metric is never published, so it cannot be what an enabled one duplicates.
+		metric, ok := config.MetricMappings[key]
+		if !ok || !metric.enabled() {
+			deduped[key] = value
+			continue
+		}
+
+		identity := datumIdentity(metric, value, config)
+		if first, ok := seen[identity]; ok {
+			msg := fmt.Sprintf("Data key %q is a duplicate of %q, with the same metric, dimensions and timestamp, and was dropped", key, first)
+			if !value.sameValue(data[first]) {
+				msg += ", despite a different value"
+			}
+			LogWarn(msg+".", "key", key, "duplicateOf", first)
+			continue
+		}
+		seen[identity] = key
+		deduped[key] = value
+	}
+	return deduped
+}
+
+// datumIdentity will return what makes the datum of a metric distinct: its namespace, name,
+// dimensions in name order and timestamp. Values without a timestamp share the run's.
+func datumIdentity(metric MetricMapping, value MetricValue, config Config) string {
+	dimensions := config.dimensions(metric)
+	parts := make([]string, 0, len(dimensions))
+	for _, d := range dimensions {
+		parts = append(parts, d.Name+"="+d.Value)
+	}
+	sort.Strings(parts)
+
+	var timestamp string
+	if value.Timestamp != nil {
+		timestamp = value.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	return strings.Join([]string{metric.namespace(config.MetricNamespace), metric.Name, strings.Join(parts, ","), timestamp}, "\x00")
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// datadogGauge is the Datadog series type of a gauge.
+const datadogGauge = 3
+
+// datadogPublisher publishes metrics to the Datadog metrics API.
+type datadogPublisher struct {
+	ctx    context.Context
+	url    string
+	apiKey string
+	client *http.Client
+
+	// now is the timestamp for metrics without their own, as Datadog points always need one.
+	now time.Time
+}
+
+// datadogPayload is the body of a request to submit series.
+type datadogPayload struct {
+	Series []datadogSeries `json:"series"`
+}
+
+// datadogSeries is a single metric and its tags, with the points submitted for it.
+type datadogSeries struct {
+	Metric string         `json:"metric"`
+	Type   int            `json:"type"`
+	Points []datadogPoint `json:"points"`
+	Tags   []string       `json:"tags,omitempty"`
+}
+
+// datadogPoint is a value of a series at a time in Unix seconds.
+type datadogPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// NewDatadogPublisher will create a publisher submitting series to the Datadog site, such as
+// datadoghq.eu, or to the URL of the API when one is given instead. The context aborts a
+// submission in flight when it is cancelled.
+func NewDatadogPublisher(ctx context.Context, apiKey string, site string, timeout time.Duration) (Publisher, error) {
+	if apiKey == "" {
+		return nil, ConfigError(fmt.Errorf("--datadog-api-key is required for the datadog backend"))
+	}
+
+	baseURL := site
+	if !strings.Contains(site, "://") {
+		baseURL = "https://api." + site
+	}
+	if _, err := url.ParseRequestURI(baseURL); err != nil {
+		return nil, ConfigError(fmt.Errorf("invalid Datadog site %q: %w", site, err))
+	}
+
+	return &datadogPublisher{
+		ctx:    ctx,
+		url:    strings.TrimSuffix(baseURL, "/") + "/api/v2/series",
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+		now:    time.Now(),
+	}, nil
+}
+
+// Describe will return the Datadog API the metrics are submitted to.
+func (p *datadogPublisher) Describe() string {
+	return fmt.Sprintf("Datadog at %s", p.url)
+}
+
+// Publish will submit a gauge series for each mapped metric in a single request.
+func (p *datadogPublisher) Publish(data PerformanceData, cfg Config) error {
+	payload := buildDatadogPayload(data, cfg, p.now)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return abortedError(p.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("datadog returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	count := len(payload.Series)
+	LogInfo(fmt.Sprintf("Submitted %d metrics to Datadog.", count), "published", count)
+	return nil
+}
+
+// printPayload will print the series which are going to be submitted.
+func (p *datadogPublisher) printPayload(w io.Writer, data PerformanceData, cfg Config) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(buildDatadogPayload(data, cfg, p.now))
+}
+
+// buildDatadogPayload will build a gauge series for each mapped metric, in data key order, with
+// its dimensions as tags. Datadog has no statistic sets, so they are submitted as their average.
+func buildDatadogPayload(data PerformanceData, cfg Config, now time.Time) datadogPayload {
+	payload := datadogPayload{Series: []datadogSeries{}}
+	for _, key := range data.keys() {
+		metric, ok := cfg.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		value := data[key]
+		average, _ := value.average()
+
+		var tags []string
+		for _, dimension := range cfg.dimensions(metric) {
+			tags = append(tags, datadogTag(dimension))
+		}
+		payload.Series = append(payload.Series, datadogSeries{
+			Metric: datadogName(metric.Name),
+			Type:   datadogGauge,
+			Points: []datadogPoint{{Timestamp: value.timestamp(now).Unix(), Value: roundValue(average, cfg.precision())}},
+			Tags:   tags,
+		})
+	}
+	return payload
+}
+
+// datadogName will replace characters which are not valid in a Datadog metric name.
+func datadogName(name string) string {
+	return sanitiseDatadog(name, func(r rune) bool { return r == '_' || r == '.' })
+}
+
+// datadogTag will render the dimension as a key:value tag, replacing characters which are
+// not valid in a Datadog tag.
+func datadogTag(dimension MetricMappingDimensions) string {
+	allowed := func(r rune) bool { return strings.ContainsRune("_-./", r) }
+	return sanitiseDatadog(dimension.Name, allowed) + ":" + strings.Map(func(r rune) rune {
+		if r == ':' || allowed(r) || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, dimension.Value)
+}
+
+// sanitiseDatadog will replace any character which is not alphanumeric or allowed with an
+// underscore, prefixing names which do not start with a letter, as Datadog requires.
+func sanitiseDatadog(name string, allowed func(rune) bool) string {
+	sanitised := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || allowed(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if sanitised == "" || !((sanitised[0] >= 'a' && sanitised[0] <= 'z') || (sanitised[0] >= 'A' && sanitised[0] <= 'Z')) {
+		sanitised = "m" + sanitised
+	}
+	return sanitised
+}
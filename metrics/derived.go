@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// errDivideByZero is returned when a derived metric would divide by zero.
+var errDivideByZero = errors.New("division by zero")
+
+// derivedExpression is a parsed derived metric expression, evaluated against the values of
+// the data keys it references.
+type derivedExpression struct {
+	eval expressionNode
+	keys []string
+}
+
+// DeriveMetrics will add the derived metrics of the config to the data, each computed from
+// the data keys its expression references. Derived metrics whose keys are missing or are
+// statistic sets without any samples, or which would divide by zero, are skipped with a warning.
+func DeriveMetrics(data PerformanceData, config Config) (PerformanceData, error) {
+	if len(config.DerivedMetrics) == 0 {
+		return data, nil
+	}
+
+	derived := make(PerformanceData, len(data)+len(config.DerivedMetrics))
+	for key, value := range data {
+		derived[key] = value
+	}
+
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(config.DerivedMetrics)) {
+		if _, ok := data[key]; ok {
+			errs = append(errs, fmt.Errorf("derived metric %q is also a data key", key))
+			continue
+		}
+		expression, err := parseDerivedExpression(config.DerivedMetrics[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("derived metric %q: %w", key, err))
+			continue
+		}
+
+		values := make(map[string]float64, len(expression.keys))
+		var missing, empty []string
+		var timestamp *time.Time
+		for _, source := range expression.keys {
+			value, ok := data[source]
+			if !ok {
+				missing = append(missing, source)
+				continue
+			}
+			average, ok := value.average()
+			if !ok {
+				empty = append(empty, source)
+				continue
+			}
+			values[source] = average
+			if timestamp == nil {
+				timestamp = value.Timestamp
+			}
+		}
+		if len(missing) > 0 {
+			LogWarn(fmt.Sprintf("Skipping derived metric %q, the data has no %s.", key, strings.Join(missing, ", ")), "key", key, "missing", missing)
+			continue
+		}
+		if len(empty) > 0 {
+			LogWarn(fmt.Sprintf("Skipping derived metric %q, %s has no samples.", key, strings.Join(empty, ", ")), "key", key, "empty", empty)
+			continue
+		}
+
+		result, err := expression.eval(values)
+		if errors.Is(err, errDivideByZero) {
+			LogWarn(fmt.Sprintf("Skipping derived metric %q, it divides by zero.", key), "key", key)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("derived metric %q: %w", key, err))
+			continue
+		}
+		derived[key] = MetricValue{Value: result, Timestamp: timestamp}
+	}
+	return derived, errors.Join(errs...)
+}
+
+// parseDerivedExpression will parse an arithmetic expression of numbers and data keys, using
+// +, -, *, / and parentheses. Keys are written bare, such as errors, or in square brackets
+// when they contain other characters, such as [request-count].
+func parseDerivedExpression(source string) (derivedExpression, error) {
+	p := &expressionParser{source: source}
+	node, err := p.expression()
+	if err != nil {
+		return derivedExpression{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.source) {
+		return derivedExpression{}, fmt.Errorf("unexpected %q at position %d of %q", p.source[p.pos], p.pos+1, source)
+	}
+	return derivedExpression{eval: node, keys: p.keys}, nil
+}
+
+// expressionNode evaluates part of an expression.
+type expressionNode func(values map[string]float64) (float64, error)
+
+// expressionParser is a recursive descent parser for derived metric expressions.
+type expressionParser struct {
+	source string
+	pos    int
+	keys   []string
+}
+
+// expression will parse terms joined by + and -.
+func (p *expressionParser) expression() (expressionNode, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.source) || (p.source[p.pos] != '+' && p.source[p.pos] != '-') {
+			return left, nil
+		}
+		op := p.source[p.pos]
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode(op, left, right)
+	}
+}
+
+// term will parse factors joined by * and /.
+func (p *expressionParser) term() (expressionNode, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.source) || (p.source[p.pos] != '*' && p.source[p.pos] != '/') {
+			return left, nil
+		}
+		op := p.source[p.pos]
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode(op, left, right)
+	}
+}
+
+// factor will parse a number, a data key, a negation or a parenthesised expression.
+func (p *expressionParser) factor() (expressionNode, error) {
+	p.skipSpace()
+	if p.pos >= len(p.source) {
+		return nil, fmt.Errorf("unexpected end of %q", p.source)
+	}
+
+	switch c := p.source[p.pos]; {
+	case c == '(':
+		p.pos++
+		node, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.source) || p.source[p.pos] != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis in %q", p.source)
+		}
+		p.pos++
+		return node, nil
+	case c == '-':
+		p.pos++
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return func(values map[string]float64) (float64, error) {
+			v, err := operand(values)
+			return -v, err
+		}, nil
+	case c == '[':
+		end := strings.IndexByte(p.source[p.pos:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("missing closing bracket in %q", p.source)
+		}
+		key := p.source[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		if key == "" {
+			return nil, fmt.Errorf("empty data key in %q", p.source)
+		}
+		return p.keyNode(key), nil
+	case c == '.' || unicode.IsDigit(rune(c)):
+		start := p.pos
+		for p.pos < len(p.source) && (p.source[p.pos] == '.' || unicode.IsDigit(rune(p.source[p.pos]))) {
+			p.pos++
+		}
+		number, err := strconv.ParseFloat(p.source[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in %q", p.source[start:p.pos], p.source)
+		}
+		return func(map[string]float64) (float64, error) { return number, nil }, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.source) && isKeyCharacter(p.source[p.pos]) {
+			p.pos++
+		}
+		return p.keyNode(p.source[start:p.pos]), nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d of %q", p.source[p.pos], p.pos+1, p.source)
+}
+
+// keyNode will record the data key as referenced and return a node looking up its value.
+func (p *expressionParser) keyNode(key string) expressionNode {
+	if !slices.Contains(p.keys, key) {
+		p.keys = append(p.keys, key)
+	}
+	return func(values map[string]float64) (float64, error) {
+		return values[key], nil
+	}
+}
+
+// skipSpace will advance past any whitespace.
+func (p *expressionParser) skipSpace() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+}
+
+// isKeyCharacter will report whether the character can be part of a bare data key.
+func isKeyCharacter(c byte) bool {
+	return c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// binaryNode will combine the operands with the operator.
+func binaryNode(op byte, left, right expressionNode) expressionNode {
+	return func(values map[string]float64) (float64, error) {
+		l, err := left(values)
+		if err != nil {
+			return 0, err
+		}
+		r, err := right(values)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '+':
+			return l + r, nil
+		case '-':
+			return l - r, nil
+		case '*':
+			return l * r, nil
+		}
+		if r == 0 {
+			return 0, errDivideByZero
+		}
+		return l / r, nil
+	}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDerivedExpression(t *testing.T) {
+	values := map[string]float64{"a": 6, "b": 3, "request-count": 40, "x.y": 2}
+
+	tests := []struct {
+		source string
+		want   float64
+		keys   []string
+	}{
+		{source: "1 + 2 * 3", want: 7},
+		{source: "(1 + 2) * 3", want: 9},
+		{source: "10 - 4 - 3", want: 3},
+		{source: "8 / 4 / 2", want: 1},
+		{source: "a / b * 100", want: 200, keys: []string{"a", "b"}},
+		{source: "a - b * 2", want: 0, keys: []string{"a", "b"}},
+		{source: "-a + 10", want: 4, keys: []string{"a"}},
+		{source: "2 * -b", want: -6, keys: []string{"b"}},
+		{source: "- -a", want: 6, keys: []string{"a"}},
+		{source: "-(a + b)", want: -9, keys: []string{"a", "b"}},
+		{source: "[request-count] / 4", want: 10, keys: []string{"request-count"}},
+		{source: "x.y * [x.y] + a / a", want: 5, keys: []string{"x.y", "a"}},
+		{source: "  .5 * a  ", want: 3, keys: []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expression, err := parseDerivedExpression(tt.source)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			got, err := expression.eval(values)
+			if err != nil {
+				t.Fatalf("eval failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("eval = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(expression.keys, tt.keys) {
+				t.Errorf("keys = %q, want %q", expression.keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestParseDerivedExpressionErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{source: "", want: "unexpected end"},
+		{source: "a +", want: "unexpected end"},
+		{source: "a b", want: `unexpected 'b' at position 3`},
+		{source: "1 + 2 )", want: `unexpected ')' at position 7`},
+		{source: "a * 2 # comment", want: `unexpected '#' at position 7`},
+		{source: "(a + b", want: "missing closing parenthesis"},
+		{source: "((a + b)", want: "missing closing parenthesis"},
+		{source: "[request-count / 2", want: "missing closing bracket"},
+		{source: "[] + 1", want: "empty data key"},
+		{source: "1.2.3 * a", want: "invalid number"},
+		{source: "* a", want: `unexpected '*' at position 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := parseDerivedExpression(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveMetrics(t *testing.T) {
+	data := PerformanceData{
+		"errors":   {Value: 5},
+		"requests": {Value: 200},
+		"zero":     {Value: 0},
+		"latency":  {Statistics: &StatisticSet{SampleCount: 4, Sum: 100}},
+		"empty":    {Statistics: &StatisticSet{SampleCount: 0}},
+	}
+	config := Config{DerivedMetrics: map[string]string{
+		"error_rate":     "errors / requests * 100",
+		"latency_x2":     "latency * 2",
+		"divide_by_zero": "errors / zero",
+		"missing_source": "errors / missing",
+		"no_samples":     "empty + errors",
+	}}
+
+	derived, err := DeriveMetrics(data, config)
+	if err != nil {
+		t.Fatalf("derive failed: %v", err)
+	}
+	if got := derived["error_rate"].Value; got != 2.5 {
+		t.Errorf("error_rate = %v, want 2.5", got)
+	}
+	if got := derived["latency_x2"].Value; got != 50 {
+		t.Errorf("latency_x2 = %v, want 50 from the average of the statistic set", got)
+	}
+	for _, key := range []string{"divide_by_zero", "missing_source", "no_samples"} {
+		if _, ok := derived[key]; ok {
+			t.Errorf("%s = %v, want it skipped", key, derived[key])
+		}
+	}
+}
+
+func TestDeriveMetricsErrors(t *testing.T) {
+	data := PerformanceData{"a": {Value: 1}}
+	tests := []struct {
+		name    string
+		derived map[string]string
+		want    string
+	}{
+		{name: "invalid expression", derived: map[string]string{"b": "a +"}, want: `derived metric "b": unexpected end`},
+		{name: "data key", derived: map[string]string{"a": "1 + 1"}, want: `derived metric "a" is also a data key`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DeriveMetrics(data, Config{DerivedMetrics: tt.derived})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
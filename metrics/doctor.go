@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go"
+)
+
+// Diagnosis is how the AWS configuration was resolved, as far as resolution got.
+type Diagnosis struct {
+	Regions          []string
+	Profile          string
+	RoleARN          string
+	Endpoint         string
+	CredentialSource string
+
+	// Expires is when the credentials expire, or zero when they do not.
+	Expires time.Time
+
+	Account string
+	ARN     string
+}
+
+// Diagnose will resolve the region, credentials and caller identity the metrics would be
+// published with, without publishing anything. When a step fails, the error names the step
+// and explains the likely cause, and the diagnosis holds what was resolved before it.
+func Diagnose(ctx context.Context, configInput Config, timeout time.Duration) (Diagnosis, error) {
+	diagnosis := Diagnosis{Regions: configInput.regions(), RoleARN: configInput.RoleARN, Endpoint: configInput.EndpointURL}
+	if !configInput.hasStaticCredentials() {
+		diagnosis.Profile = configInput.Profile
+	}
+
+	if configInput.Region == "" {
+		return diagnosis, ConfigError(fmt.Errorf("resolving the region failed: no region is set, use region in the config, --region or AWS_REGION"))
+	}
+	if configInput.Profile == "" && configInput.AccessKeyID == "" && configInput.SecretAccessKey == "" {
+		return diagnosis, ConfigError(fmt.Errorf("resolving the credentials failed: no profile or static credentials are set, use profile in the config, --profile or AWS_PROFILE"))
+	}
+
+	cfg, err := loadAWSConfig(ctx, configInput, timeout)
+	if err != nil {
+		return diagnosis, ConfigError(fmt.Errorf("loading the AWS configuration failed: %w", explainAWSError(err, configInput)))
+	}
+
+	retrieveCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	creds, err := cfg.Credentials.Retrieve(retrieveCtx)
+	if err != nil {
+		return diagnosis, ConfigError(fmt.Errorf("retrieving the credentials failed: %w", explainAWSError(deadlineError(err, timeout), configInput)))
+	}
+	diagnosis.CredentialSource = creds.Source
+	if creds.CanExpire {
+		diagnosis.Expires = creds.Expires
+		if creds.Expired() {
+			return diagnosis, ConfigError(fmt.Errorf("retrieving the credentials failed: the credentials expired at %s, refresh them and try again", creds.Expires.Format(time.RFC3339)))
+		}
+	}
+
+	diagnosis.Account, diagnosis.ARN, err = callerIdentity(ctx, cfg, timeout)
+	if err != nil {
+		return diagnosis, ConfigError(fmt.Errorf("looking up the caller identity failed: %w", explainAWSError(err, configInput)))
+	}
+	return diagnosis, nil
+}
+
+// explainAWSError will add the likely cause to errors from resolving the AWS configuration
+// which are common during setup.
+func explainAWSError(err error, configInput Config) error {
+	var profileErr config.SharedConfigProfileNotExistError
+	if errors.As(err, &profileErr) {
+		return fmt.Errorf("profile %q was not found in the AWS config or credentials files: %w", profileErr.Profile, err)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ExpiredToken", "ExpiredTokenException":
+			return fmt.Errorf("the session token has expired, refresh the credentials and try again: %w", err)
+		case "InvalidClientTokenId", "SignatureDoesNotMatch":
+			return fmt.Errorf("the credentials were rejected, check the access key and secret: %w", err)
+		case "AccessDenied":
+			if configInput.RoleARN != "" {
+				return fmt.Errorf("the role %s could not be assumed: %w", configInput.RoleARN, err)
+			}
+		}
+	}
+
+	if strings.Contains(strings.ToLower(err.Error()), "expired") {
+		return fmt.Errorf("the credentials have expired, refresh them (for example with aws sso login) and try again: %w", err)
+	}
+	return err
+}
+
+// String will describe the parts of the diagnosis which were resolved, one per line.
+func (d Diagnosis) String() string {
+	var lines []string
+	add := func(label, value string) {
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("%-19s %s", label+":", value))
+		}
+	}
+	add("Region", strings.Join(d.Regions, ", "))
+	add("Profile", d.Profile)
+	add("Role", d.RoleARN)
+	add("Endpoint", d.Endpoint)
+	add("Credential source", d.CredentialSource)
+	if !d.Expires.IsZero() {
+		add("Expires", d.Expires.Format(time.RFC3339))
+	}
+	add("Account", d.Account)
+	add("ARN", d.ARN)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// emfPublisher writes metrics as CloudWatch Embedded Metric Format log events, for log-based
+// metric pipelines such as Lambda functions.
+type emfPublisher struct {
+	// path is the file the events are written to, or stdout when empty.
+	path string
+
+	// now is the timestamp for metrics without their own, as EMF events always need one.
+	now time.Time
+}
+
+// emfMetadata is the _aws block of an EMF event, describing which of its fields are metrics.
+type emfMetadata struct {
+	Timestamp         int64              `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricSection `json:"CloudWatchMetrics"`
+}
+
+// emfMetricSection lists the metrics of an event, their namespace and dimensions.
+type emfMetricSection struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+// emfMetricDefinition is the name, unit and storage resolution of a metric in an event.
+type emfMetricDefinition struct {
+	Name              string `json:"Name"`
+	Unit              string `json:"Unit"`
+	StorageResolution int32  `json:"StorageResolution"`
+}
+
+// emfEvent is an EMF event being built, holding the metrics which share a namespace,
+// dimensions and timestamp.
+type emfEvent struct {
+	group   string
+	section emfMetricSection
+	time    time.Time
+	fields  map[string]any
+}
+
+// NewEMFPublisher will create a publisher writing EMF events to the file at the path, replacing
+// it on each publish, or to stdout when no path is given.
+func NewEMFPublisher(path string) Publisher {
+	return &emfPublisher{path: path, now: time.Now()}
+}
+
+// Describe will return where the EMF events are written.
+func (p *emfPublisher) Describe() string {
+	if p.path == "" {
+		return "EMF logs on stdout"
+	}
+	return fmt.Sprintf("EMF logs in the file %s", p.path)
+}
+
+// Publish will write an EMF event as a JSON line for each group of mapped metrics sharing a
+// namespace, dimensions and timestamp.
+func (p *emfPublisher) Publish(data PerformanceData, cfg Config) error {
+	events := buildEMFEvents(data, cfg, p.now)
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if p.path != "" {
+		var err error
+		file, err = os.Create(p.path)
+		if err != nil {
+			return err
+		}
+		w = file
+	}
+	writer := bufio.NewWriter(w)
+	err := writeEMFEvents(writer, events)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var count int
+	for _, event := range events {
+		count += len(event.section.Metrics)
+	}
+	LogInfo(fmt.Sprintf("Wrote %d metrics in %d EMF events.", count, len(events)), "published", count, "events", len(events))
+	return nil
+}
+
+// writeEMFEvents will encode each event with its _aws metadata block.
+func writeEMFEvents(w io.Writer, events []*emfEvent) error {
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		event.fields["_aws"] = emfMetadata{
+			Timestamp:         event.time.UnixMilli(),
+			CloudWatchMetrics: []emfMetricSection{event.section},
+		}
+		if err := encoder.Encode(event.fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildEMFEvents will group the mapped metrics into events, in data key order. A metric goes into
+// a new event when its group's event is full or already has a field of the same name. Metrics
+// named the same as one of their dimensions are skipped with a warning, as the event has a
+// single field for both.
+func buildEMFEvents(data PerformanceData, cfg Config, now time.Time) []*emfEvent {
+	precision := cfg.precision()
+	var events []*emfEvent
+	for _, key := range data.keys() {
+		metric, ok := cfg.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		value := data[key]
+		timestamp := value.timestamp(now)
+		namespace := metric.namespace(cfg.MetricNamespace)
+
+		dimensions := cfg.dimensions(metric)
+		names := make([]string, 0, len(dimensions))
+		var group strings.Builder
+		fmt.Fprintf(&group, "%s\x00%d", namespace, timestamp.UnixMilli())
+		for _, dimension := range dimensions {
+			names = append(names, dimension.Name)
+			fmt.Fprintf(&group, "\x00%s=%s", dimension.Name, dimension.Value)
+		}
+
+		if slices.Contains(names, metric.Name) {
+			LogWarn(fmt.Sprintf("Skipping data key %q, its metric name %s is also the name of one of its dimensions.", key, metric.Name), "key", key, "name", metric.Name)
+			continue
+		}
+
+		index := slices.IndexFunc(events, func(e *emfEvent) bool {
+			_, taken := e.fields[metric.Name]
+			return e.group == group.String() && !taken && len(e.section.Metrics) < maxMetricsPerEvent
+		})
+		if index < 0 {
+			event := &emfEvent{
+				group:   group.String(),
+				section: emfMetricSection{Namespace: namespace, Dimensions: [][]string{names}},
+				time:    timestamp,
+				fields:  make(map[string]any),
+			}
+			for _, dimension := range dimensions {
+				event.fields[dimension.Name] = dimension.Value
+			}
+			index = len(events)
+			events = append(events, event)
+		}
+
+		event := events[index]
+		event.section.Metrics = append(event.section.Metrics, emfMetricDefinition{
+			Name:              metric.Name,
+			Unit:              string(metric.unit()),
+			StorageResolution: cfg.storageResolution(metric),
+		})
+		// EMF has no statistic sets, so they are written as their average.
+		average, _ := value.average()
+		event.fields[metric.Name] = roundValue(average, precision)
+	}
+	return events
+}
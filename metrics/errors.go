@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	// exitCodeFailure is the exit code for errors without a category.
+	exitCodeFailure = 1
+
+	// exitCodeConfig is the exit code when the config or data could not be loaded.
+	exitCodeConfig = 2
+
+	// exitCodeValidation is the exit code when the config or data is invalid.
+	exitCodeValidation = 3
+
+	// exitCodePublish is the exit code when AWS rejected the metrics.
+	exitCodePublish = 4
+
+	// exitCodeInterrupted is the exit code when the publish was interrupted, following
+	// the shell convention for SIGINT.
+	exitCodeInterrupted = 130
+)
+
+// categorisedError is an error carrying the exit code for its category.
+type categorisedError struct {
+	err  error
+	code int
+}
+
+// Error will return the message of the underlying error.
+func (e *categorisedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap will return the underlying error.
+func (e *categorisedError) Unwrap() error {
+	return e.err
+}
+
+// Categorise will wrap the error with the exit code, leaving nil errors untouched. An error
+// which is already categorised keeps its category, as the more specific of the two.
+func Categorise(err error, code int) error {
+	var categorised *categorisedError
+	if err == nil || errors.As(err, &categorised) {
+		return err
+	}
+	return &categorisedError{err: err, code: code}
+}
+
+// ConfigError will categorise the error as a failure to load the config or data.
+func ConfigError(err error) error {
+	return Categorise(err, exitCodeConfig)
+}
+
+// ValidationError will categorise the error as invalid config or data.
+func ValidationError(err error) error {
+	return Categorise(err, exitCodeValidation)
+}
+
+// PublishError will categorise the error as a failure to publish the metrics.
+func PublishError(err error) error {
+	return Categorise(err, exitCodePublish)
+}
+
+// InterruptedError will categorise the error as the publish being interrupted.
+func InterruptedError(err error) error {
+	return Categorise(err, exitCodeInterrupted)
+}
+
+// failedKeysError is a publish error which also names the data keys that were not published,
+// and counts the metrics which were.
+type failedKeysError struct {
+	err       error
+	keys      []string
+	published int
+}
+
+// Error will return the message of the underlying error.
+func (e *failedKeysError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap will return the underlying error.
+func (e *failedKeysError) Unwrap() error {
+	return e.err
+}
+
+// abortedError will categorise the error of a request stopped by the context being cancelled, such
+// as by an interrupt, as the publish being interrupted.
+func abortedError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	return InterruptedError(fmt.Errorf("interrupted before the metrics were published: %w", err))
+}
+
+// withFailedKeys will attach the data keys which were not published, and the number of metrics
+// which were, to the error, leaving nil errors untouched.
+func withFailedKeys(err error, keys []string, published int) error {
+	if err == nil || len(keys) == 0 {
+		return err
+	}
+	return &failedKeysError{err: err, keys: keys, published: published}
+}
+
+// FailedKeys will return the data keys which a publish error reports were not published, so
+// they can be retried.
+func FailedKeys(err error) []string {
+	var failed *failedKeysError
+	if errors.As(err, &failed) {
+		return failed.keys
+	}
+	return nil
+}
+
+// publishedCount will return the number of metrics a publish error reports were published
+// before it failed.
+func publishedCount(err error) int {
+	var failed *failedKeysError
+	if errors.As(err, &failed) {
+		return failed.published
+	}
+	return 0
+}
+
+// ExitCode will return the exit code for the error's category.
+func ExitCode(err error) int {
+	var categorised *categorisedError
+	if errors.As(err, &categorised) {
+		return categorised.code
+	}
+	return exitCodeFailure
+}
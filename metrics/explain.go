@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ExplainOptions controls how each data key is explained.
+type ExplainOptions struct {
+	// Selected is the data keys given with --metric, or empty when every key is kept.
+	Selected []string
+
+	// Redact masks the value of every dimension, rather than only the sensitive ones.
+	Redact bool
+}
+
+// ExplainData will write, for each data key and derived metric, the datum it maps to and whether
+// it would be published, or why it is skipped. The loaded data is as read from the data files, and
+// the prepared data as it would be published, after deriving, filtering, scaling and deduplicating.
+func ExplainData(w io.Writer, loaded, prepared PerformanceData, config Config, opts ExplainOptions) error {
+	keys := loaded.keys()
+	for _, key := range slices.Sorted(maps.Keys(config.DerivedMetrics)) {
+		if _, ok := loaded[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	precision := config.precision()
+	var out strings.Builder
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Fprintln(&out)
+		}
+		fmt.Fprintln(&out, key)
+		if source, ok := config.DerivedMetrics[key]; ok {
+			fmt.Fprintf(&out, "  Derived from: %s\n", source)
+		}
+
+		metric, mapped := config.MetricMappings[key]
+		if mapped {
+			name := metric.Name
+			if metric.passthrough {
+				name += " (passthrough)"
+			}
+			fmt.Fprintf(&out, "  Metric:       %s\n", name)
+			if metric.Description != "" {
+				fmt.Fprintf(&out, "  Description:  %s\n", metric.Description)
+			}
+			fmt.Fprintf(&out, "  Namespace:    %s\n", explainMissing(metric.namespace(config.MetricNamespace)))
+			fmt.Fprintf(&out, "  Unit:         %s\n", metric.unit())
+			fmt.Fprintf(&out, "  Resolution:   %ds\n", config.storageResolution(metric))
+			fmt.Fprintf(&out, "  Dimensions:   %s\n", explainDimensions(config.dimensions(metric), opts.Redact))
+		}
+		if value, ok := explainValue(loaded, prepared, key, metric, precision); ok {
+			fmt.Fprintf(&out, "  Value:        %s\n", value)
+		}
+		fmt.Fprintf(&out, "  Outcome:      %s\n", explainOutcome(loaded, prepared, key, config, opts))
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// explainMissing will return the value, or a placeholder when it is empty.
+func explainMissing(value string) string {
+	if value == "" {
+		return "(not set)"
+	}
+	return value
+}
+
+// explainDimensions will list the merged dimensions of a metric, masking the sensitive values
+// or every value when redacting.
+func explainDimensions(dimensions []MetricMappingDimensions, redact bool) string {
+	if len(dimensions) == 0 {
+		return "(none)"
+	}
+	parts := make([]string, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		if dimension.Sensitive || redact {
+			dimension.Value = redactedValue
+		}
+		parts = append(parts, dimension.Name+"="+dimension.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// explainValue will describe the value as loaded, and the scale and offset applied to it when
+// the mapping has either, reporting false when there is no value to describe.
+func explainValue(loaded, prepared PerformanceData, key string, metric MetricMapping, precision int) (string, bool) {
+	raw, ok := loaded[key]
+	published, inPrepared := prepared[key]
+	switch {
+	case !ok && !inPrepared:
+		return "", false
+	case !ok:
+		return published.display(precision), true
+	}
+
+	scale := 1.0
+	if metric.Scale != nil {
+		scale = *metric.Scale
+	}
+	if scale == 1 && metric.Offset == 0 {
+		return raw.display(precision), true
+	}
+	if !inPrepared {
+		published = raw.transform(metric)
+	}
+	return fmt.Sprintf("%s, scaled by %v with an offset of %v to %s", raw.display(precision), scale, metric.Offset, published.display(precision)), true
+}
+
+// explainOutcome will say whether the data key would be published, or why it is skipped, checking
+// in the order the data is prepared and published.
+func explainOutcome(loaded, prepared PerformanceData, key string, config Config, opts ExplainOptions) string {
+	metric, mapped := config.MetricMappings[key]
+	value, ok := prepared[key]
+	_, derived := config.DerivedMetrics[key]
+
+	switch {
+	case len(opts.Selected) > 0 && !slices.Contains(opts.Selected, key):
+		return "skipped, it was not selected with --metric"
+	case !ok && derived:
+		return "skipped, a data key it is derived from is missing or it divides by zero"
+	case !ok:
+		return "skipped, " + explainDuplicate(loaded, prepared, key, config)
+	case !mapped:
+		return "skipped, it has no metric mapping; add one to metricMappings or pass --passthrough"
+	case !metric.enabled():
+		return "skipped, its metric is disabled with enabled: false"
+	case !value.finite():
+		return "skipped, its value is NaN or infinite"
+	case metric.suppressed(value):
+		return "skipped, its value is outside of its publishIfAbove or publishIfBelow condition"
+	case metric.namespace(config.MetricNamespace) == "":
+		return "rejected, no metric namespace is set"
+	}
+	if errs := CheckMetrics(PerformanceData{key: value}, config); len(errs) > 0 {
+		return "rejected, " + errs[0].Error()
+	}
+	return "would be published"
+}
+
+// explainDuplicate will name the data key a dropped key was a duplicate of, when it can be found.
+func explainDuplicate(loaded, prepared PerformanceData, key string, config Config) string {
+	identity := datumIdentity(config.MetricMappings[key], loaded[key], config)
+	for _, other := range prepared.keys() {
+		mapping, ok := config.MetricMappings[other]
+		if ok && other != key && datumIdentity(mapping, prepared[other], config) == identity {
+			return fmt.Sprintf("it is a duplicate of %q, with the same metric, dimensions and timestamp", other)
+		}
+	}
+	return "it is a duplicate of another data key, with the same metric, dimensions and timestamp"
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// filePublisher writes metrics to a local file as JSON lines, for testing and offline use.
+type filePublisher struct {
+	path string
+}
+
+// fileDatum is a line in the output file describing a single datum.
+type fileDatum struct {
+	Namespace         string              `json:"namespace"`
+	Name              string              `json:"name"`
+	Value             *float64            `json:"value,omitempty"`
+	Statistics        *types.StatisticSet `json:"statistics,omitempty"`
+	Unit              types.StandardUnit  `json:"unit"`
+	StorageResolution int32               `json:"storageResolution"`
+	Timestamp         *time.Time          `json:"timestamp,omitempty"`
+	Dimensions        []auditDimension    `json:"dimensions,omitempty"`
+}
+
+// NewFilePublisher will create a publisher writing to the file at the path, replacing it on each publish.
+func NewFilePublisher(path string) (Publisher, error) {
+	if path == "" {
+		return nil, ConfigError(fmt.Errorf("--out is required for the file backend"))
+	}
+	return &filePublisher{path: path}, nil
+}
+
+// Describe will return the file the metrics are written to.
+func (p *filePublisher) Describe() string {
+	return fmt.Sprintf("the file %s", p.path)
+}
+
+// Publish will write a JSON line for each mapped metric, in data key order. Only timestamps
+// from the data are written, so the same input always produces the same file.
+func (p *filePublisher) Publish(data PerformanceData, cfg Config) error {
+	file, err := os.Create(p.path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	var count int
+	for _, key := range data.keys() {
+		metric, ok := cfg.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		if err := encoder.Encode(newFileDatum(metric, data[key], cfg)); err != nil {
+			file.Close()
+			return err
+		}
+		count++
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	LogInfo(fmt.Sprintf("Wrote %d metrics to %s.", count, p.path), "published", count, "file", p.path)
+	return nil
+}
+
+// newFileDatum will describe the metric's value as a line of the output file.
+func newFileDatum(metric MetricMapping, value MetricValue, cfg Config) fileDatum {
+	precision := cfg.precision()
+	datum := fileDatum{
+		Namespace:         metric.namespace(cfg.MetricNamespace),
+		Name:              metric.Name,
+		Unit:              metric.unit(),
+		StorageResolution: cfg.storageResolution(metric),
+		Timestamp:         value.Timestamp,
+	}
+	if value.Statistics != nil {
+		datum.Statistics = &types.StatisticSet{
+			SampleCount: aws.Float64(value.Statistics.SampleCount),
+			Sum:         aws.Float64(roundValue(value.Statistics.Sum, precision)),
+			Minimum:     aws.Float64(roundValue(value.Statistics.Minimum, precision)),
+			Maximum:     aws.Float64(roundValue(value.Statistics.Maximum, precision)),
+		}
+	} else {
+		datum.Value = aws.Float64(roundValue(value.Value, precision))
+	}
+	for _, dimension := range cfg.dimensions(metric) {
+		datum.Dimensions = append(datum.Dimensions, auditDimension{Name: dimension.Name, Value: dimension.Value})
+	}
+	return datum
+}
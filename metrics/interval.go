@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// publishState is the state file recording when metrics were last published.
+type publishState struct {
+	LastPublished time.Time `json:"lastPublished"`
+}
+
+// DefaultStateFile will return the path of the state file in the user cache directory.
+func DefaultStateFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", ConfigError(fmt.Errorf("unable to find the cache directory for the state file: %w", err))
+	}
+	return filepath.Join(dir, "personal-performance-metrics", "state.json"), nil
+}
+
+// CheckMinInterval will return an error when the state file records a publish less than the
+// interval before now. A missing state file means nothing has been published yet.
+func CheckMinInterval(path string, interval time.Duration, now time.Time) error {
+	file, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return ConfigError(fmt.Errorf("unable to read state file: %w", err))
+	}
+	var state publishState
+	if err := json.Unmarshal(file, &state); err != nil {
+		return ConfigError(fmt.Errorf("unable to parse state file %s: %w", path, err))
+	}
+
+	elapsed := now.Sub(state.LastPublished)
+	if elapsed >= interval {
+		return nil
+	}
+	return ValidationError(fmt.Errorf("metrics were last published at %s, %s ago, which is within the --min-interval of %s; wait %s or pass --force to publish anyway",
+		state.LastPublished.Format(time.RFC3339), elapsed.Round(time.Second), interval, (interval - elapsed).Round(time.Second)))
+}
+
+// RecordPublish will write the time of the publish to the state file, creating its directory
+// when needed.
+func RecordPublish(path string, published time.Time) error {
+	file, err := json.Marshal(publishState{LastPublished: published.UTC()})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create the state file directory: %w", err)
+	}
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// maxQueriesPerRequest is the CloudWatch limit of queries in a single GetMetricData call.
+const maxQueriesPerRequest = 500
+
+// livePreviewer is implemented by publishers which can look up the values the backend
+// currently holds for the metrics.
+type livePreviewer interface {
+	currentValues(data PerformanceData, cfg Config, window time.Duration) (PerformanceData, error)
+}
+
+// CurrentValues will return the average of each mapped metric over the window ending now,
+// as the backend currently reports it. Metrics without any recent datapoints are left out,
+// so they show as new when the result is used as the previous data of the preview.
+func CurrentValues(publisher Publisher, data PerformanceData, cfg Config, window time.Duration) (PerformanceData, error) {
+	previewer, ok := publisher.(livePreviewer)
+	if !ok {
+		return nil, ConfigError(fmt.Errorf("live preview is not supported when publishing to %s", publisher.Describe()))
+	}
+	return previewer.currentValues(data, cfg, window)
+}
+
+// currentValues will query the first region for the average of each metric over the window.
+func (p *cloudWatchPublisher) currentValues(data PerformanceData, cfg Config, window time.Duration) (PerformanceData, error) {
+	// The period must be a whole number of minutes, so the window is rounded up to one.
+	period := int32((window + time.Minute - 1) / time.Minute * 60)
+	end := p.now
+	start := end.Add(-time.Duration(period) * time.Second)
+
+	var keys []string
+	var queries []types.MetricDataQuery
+	for _, key := range data.keys() {
+		metric, ok := cfg.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		var dimensions []types.Dimension
+		for _, dimension := range cfg.dimensions(metric) {
+			dimensions = append(dimensions, types.Dimension{Name: aws.String(dimension.Name), Value: aws.String(dimension.Value)})
+		}
+		queries = append(queries, types.MetricDataQuery{
+			Id: aws.String(fmt.Sprintf("m%d", len(queries))),
+			MetricStat: &types.MetricStat{
+				Metric: &types.Metric{
+					Namespace:  aws.String(metric.namespace(cfg.MetricNamespace)),
+					MetricName: aws.String(metric.Name),
+					Dimensions: dimensions,
+				},
+				Period: aws.Int32(period),
+				Stat:   aws.String(string(types.StatisticAverage)),
+			},
+		})
+		keys = append(keys, key)
+	}
+
+	client := p.clients[0]
+	current := PerformanceData{}
+	for offset := 0; offset < len(queries); offset += maxQueriesPerRequest {
+		batch := queries[offset:min(offset+maxQueriesPerRequest, len(queries))]
+		input := &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: batch,
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(end),
+		}
+		paginator := cloudwatch.NewGetMetricDataPaginator(client.client, input)
+		for paginator.HasMorePages() {
+			ctx, cancel := context.WithTimeout(p.ctx, p.opts.Timeout)
+			page, err := paginator.NextPage(ctx)
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("unable to fetch current values from %s: %w", client.region, deadlineError(err, p.opts.Timeout))
+			}
+			for _, result := range page.MetricDataResults {
+				var index int
+				if _, err := fmt.Sscanf(aws.ToString(result.Id), "m%d", &index); err != nil || len(result.Values) == 0 {
+					continue
+				}
+				// Values are newest first, so the first is the average of the latest period.
+				current[keys[index]] = MetricValue{Value: result.Values[0]}
+			}
+		}
+	}
+	return current, nil
+}
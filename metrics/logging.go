@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/pterm/pterm"
+)
+
+// LogOptions configures how status messages, warnings and errors are reported.
+type LogOptions struct {
+	// Writer receives the messages, defaulting to stdout.
+	Writer io.Writer
+
+	// JSON selects structured JSON logs instead of plain text.
+	JSON bool
+
+	// Quiet suppresses everything but errors.
+	Quiet bool
+
+	// Verbose includes debugging messages, such as each request sent to CloudWatch.
+	Verbose bool
+}
+
+// logOptions are the options set by SetupLogging.
+var logOptions LogOptions
+
+// structuredLogger is used for status messages when the JSON log format is selected.
+var structuredLogger *slog.Logger
+
+// SetupLogging will configure how messages are reported for the rest of the run.
+func SetupLogging(opts LogOptions) {
+	logOptions = opts
+	structuredLogger = nil
+	if opts.JSON {
+		level := slog.LevelInfo
+		if opts.Verbose {
+			level = slog.LevelDebug
+		}
+		structuredLogger = slog.New(slog.NewJSONHandler(statusWriter(), &slog.HandlerOptions{Level: level}))
+	}
+}
+
+// statusWriter will return where status messages are written.
+func statusWriter() io.Writer {
+	if logOptions.Writer == nil {
+		return os.Stdout
+	}
+	return logOptions.Writer
+}
+
+// LogDebug will report a debugging message, with the attributes only included in structured logs.
+// Debugging messages are only reported in verbose mode, and are suppressed in quiet mode.
+func LogDebug(msg string, args ...any) {
+	if !logOptions.Verbose || logOptions.Quiet {
+		return
+	}
+	if structuredLogger != nil {
+		structuredLogger.Debug(msg, args...)
+		return
+	}
+	pterm.Debug.WithDebugger(false).WithWriter(statusWriter()).Println(msg)
+}
+
+// LogInfo will report a status message, with the attributes only included in structured logs.
+// Status messages are suppressed in quiet mode.
+func LogInfo(msg string, args ...any) {
+	if logOptions.Quiet {
+		return
+	}
+	if structuredLogger != nil {
+		structuredLogger.Info(msg, args...)
+		return
+	}
+	fmt.Fprintln(statusWriter(), msg)
+}
+
+// LogWarn will report a warning, with the attributes only included in structured logs.
+// Warnings are suppressed in quiet mode.
+func LogWarn(msg string, args ...any) {
+	if logOptions.Quiet {
+		return
+	}
+	if structuredLogger != nil {
+		structuredLogger.Warn(msg, args...)
+		return
+	}
+	pterm.Warning.WithWriter(statusWriter()).Println(msg)
+}
+
+// LogError will report an error, with the attributes only included in structured logs.
+func LogError(msg string, args ...any) {
+	if structuredLogger != nil {
+		structuredLogger.Error(msg, args...)
+		return
+	}
+	fmt.Fprintln(statusWriter(), msg)
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import "time"
+
+// MetaMetrics will return the data and config to publish the meta-metrics of a run, the
+// number of metrics it published and how long it took, into the namespace.
+func MetaMetrics(namespace string, published int, duration time.Duration) (PerformanceData, Config) {
+	data := PerformanceData{
+		"metricsPublished":       {Value: float64(published)},
+		"publishDurationSeconds": {Value: duration.Seconds()},
+	}
+	cfg := Config{
+		MetricNamespace: namespace,
+		MetricMappings: map[string]MetricMapping{
+			"metricsPublished":       {Name: "MetricsPublished", Unit: "Count"},
+			"publishDurationSeconds": {Name: "PublishDurationSeconds", Unit: "Seconds"},
+		},
+	}
+	return data, cfg
+}
@@ -0,0 +1,102 @@
+// Package metrics loads performance data and its metric mappings, previews the
+// metrics and publishes them to CloudWatch or one of the other backends.
+package metrics
+
+import "time"
+
+const (
+	// OutputTable, OutputJSON, OutputAWSCLI and OutputMarkdown are the formats the metrics can be previewed in.
+	OutputTable    = "table"
+	OutputJSON     = "json"
+	OutputAWSCLI   = "aws-cli"
+	OutputMarkdown = "markdown"
+
+	// metricTypePercent is the metric type for percentages, which must be between 0 and 100.
+	metricTypePercent = "percent"
+
+	// thresholdAbove and thresholdBelow are the directions in which a metric's thresholds are crossed.
+	thresholdAbove = "above"
+	thresholdBelow = "below"
+
+	// severityWarn and severityCritical are the thresholds a value can cross.
+	severityWarn     = "warn"
+	severityCritical = "critical"
+
+	// MergeError and MergeLastWins are the strategies for a key found in more than one data file.
+	MergeError    = "error"
+	MergeLastWins = "last-wins"
+
+	// DataFormatYAML, DataFormatJSON and DataFormatCSV are the data file formats, which are
+	// detected from the file extension when none is given.
+	DataFormatYAML = "yaml"
+	DataFormatJSON = "json"
+	DataFormatCSV  = "csv"
+
+	// defaultKeySeparator joins the keys of nested data when no separator is given.
+	defaultKeySeparator = "."
+
+	// currentConfigVersion is the config version this release expects.
+	currentConfigVersion = 1
+
+	// extensionKeyPrefix marks config keys which are ignored, such as those holding YAML anchors.
+	extensionKeyPrefix = "x-"
+
+	// maxEpochSeconds is the limit of epoch timestamps read as seconds, in the year 2286.
+	maxEpochSeconds = 1e10
+
+	// minEpochMilliseconds and maxEpochMilliseconds are the limits of epoch timestamps read
+	// as milliseconds, from 1973 until the year 5138.
+	minEpochMilliseconds = 1e11
+	maxEpochMilliseconds = 1e14
+
+	// maxMetricsPerEvent is the EMF limit of metrics in a single log event.
+	maxMetricsPerEvent = 100
+
+	// stdinDataFile is the data file path which reads the data from stdin.
+	stdinDataFile = "-"
+
+	// defaultFetchTimeout is how long fetching the data from a URL may take when no timeout is given.
+	defaultFetchTimeout = 30 * time.Second
+
+	// defaultPrecision is the number of decimal places values are rounded to when unset.
+	defaultPrecision = 2
+
+	// MaxMetricAge is how far in the past CloudWatch accepts datum timestamps.
+	MaxMetricAge = 14 * 24 * time.Hour
+
+	// MaxMetricLead is how far in the future CloudWatch accepts datum timestamps.
+	MaxMetricLead = 2 * time.Hour
+
+	// retryBaseDelay is the delay before the first retry, doubling with each attempt.
+	retryBaseDelay = 500 * time.Millisecond
+
+	// maxRetryBackoffShift limits the backoff growth to 64 times the base delay, 32 seconds.
+	maxRetryBackoffShift = 6
+
+	// maxHighResolutionAge is how far in the past high resolution datums are accepted.
+	maxHighResolutionAge = 3 * time.Hour
+
+	// highStorageResolution and standardStorageResolution are the storage resolutions in seconds.
+	highStorageResolution     = 1
+	standardStorageResolution = 60
+
+	// maxDatumsPerRequest is the CloudWatch limit of datums in a single PutMetricData call.
+	maxDatumsPerRequest = 1000
+
+	// maxNameLength is the longest namespace, metric name or dimension name CloudWatch accepts.
+	maxNameLength = 255
+
+	// maxDimensionValueLength is the longest dimension value CloudWatch accepts.
+	maxDimensionValueLength = 1024
+
+	// maxDimensionsPerMetric is the most dimensions CloudWatch accepts on a metric.
+	maxDimensionsPerMetric = 30
+
+	// namespaceCharacters are the characters CloudWatch allows in a namespace.
+	namespaceCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-_/#: "
+)
+
+// configChanges describes what changed in each config version, for the warning about an older config.
+var configChanges = map[int]string{
+	1: "added the version field, unknown keys are now reported",
+}
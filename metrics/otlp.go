@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// otlpScope is the instrumentation scope the exported metrics are reported under.
+const otlpScope = "personal-performance-metrics"
+
+// otlpPublisher exports metrics to an OpenTelemetry collector over OTLP.
+type otlpPublisher struct {
+	ctx      context.Context
+	endpoint string
+	exporter sdkmetric.Exporter
+	timeout  time.Duration
+
+	// now is the timestamp for data points without their own.
+	now time.Time
+}
+
+// NewOTLPPublisher will create a publisher exporting to the endpoint, using gRPC for the
+// grpc and grpcs schemes and HTTP for the http and https schemes.
+func NewOTLPPublisher(ctx context.Context, endpoint string, timeout time.Duration) (Publisher, error) {
+	if endpoint == "" {
+		return nil, ConfigError(fmt.Errorf("--otlp-endpoint is required for the otlp backend"))
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, ConfigError(fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err))
+	}
+
+	var exporter sdkmetric.Exporter
+	switch u.Scheme {
+	case "grpc", "grpcs":
+		options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(u.Host), otlpmetricgrpc.WithTimeout(timeout)}
+		if u.Scheme == "grpc" {
+			options = append(options, otlpmetricgrpc.WithInsecure())
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, options...)
+	case "http", "https":
+		exporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint), otlpmetrichttp.WithTimeout(timeout))
+	default:
+		return nil, ConfigError(fmt.Errorf("OTLP endpoint %q must use the grpc, grpcs, http or https scheme", endpoint))
+	}
+	if err != nil {
+		return nil, ConfigError(fmt.Errorf("unable to create OTLP exporter: %w", err))
+	}
+
+	return &otlpPublisher{ctx: ctx, endpoint: endpoint, exporter: exporter, timeout: timeout, now: time.Now()}, nil
+}
+
+// Describe will return the collector the metrics are exported to.
+func (p *otlpPublisher) Describe() string {
+	return fmt.Sprintf("the OTLP collector at %s", p.endpoint)
+}
+
+// Publish will export the metrics as gauges, or summaries for statistic sets.
+func (p *otlpPublisher) Publish(data PerformanceData, cfg Config) error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+
+	metrics := otlpMetrics(data, cfg, p.now)
+	err := p.exporter.Export(ctx, &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(semconv.ServiceName(otlpScope)),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope:   instrumentation.Scope{Name: otlpScope},
+			Metrics: metrics,
+		}},
+	})
+	if err != nil {
+		return abortedError(p.ctx, err)
+	}
+
+	LogInfo(fmt.Sprintf("Exported %d metrics to %s.", len(metrics), p.endpoint), "published", len(metrics))
+	return nil
+}
+
+// close will shut down the exporter, flushing anything it buffers. The shutdown is bounded by
+// the timeout, but not cancelled by an interrupt, so the connection is still released.
+func (p *otlpPublisher) close() error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(p.ctx), p.timeout)
+	defer cancel()
+	if err := p.exporter.Shutdown(ctx); err != nil {
+		return fmt.Errorf("unable to shut down the OTLP exporter: %w", err)
+	}
+	return nil
+}
+
+// otlpMetrics will convert the mapped metrics into OTLP metric data, with the
+// dimensions of each metric as its attributes.
+func otlpMetrics(data PerformanceData, cfg Config, now time.Time) []metricdata.Metrics {
+	var metrics []metricdata.Metrics
+	for _, key := range data.keys() {
+		metric, ok := cfg.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		value := data[key]
+
+		var attributes []attribute.KeyValue
+		for _, dimension := range cfg.dimensions(metric) {
+			attributes = append(attributes, attribute.String(dimension.Name, dimension.Value))
+		}
+		set := attribute.NewSet(attributes...)
+		timestamp := value.timestamp(now)
+
+		var aggregation metricdata.Aggregation
+		if value.Statistics == nil {
+			aggregation = metricdata.Gauge[float64]{
+				DataPoints: []metricdata.DataPoint[float64]{{
+					Attributes: set,
+					Time:       timestamp,
+					Value:      roundValue(value.Value, cfg.precision()),
+				}},
+			}
+		} else {
+			stats := value.Statistics
+			aggregation = metricdata.Summary{
+				DataPoints: []metricdata.SummaryDataPoint{{
+					Attributes: set,
+					Time:       timestamp,
+					Count:      uint64(stats.SampleCount),
+					Sum:        roundValue(stats.Sum, cfg.precision()),
+					QuantileValues: []metricdata.QuantileValue{
+						{Quantile: 0, Value: roundValue(stats.Minimum, cfg.precision())},
+						{Quantile: 1, Value: roundValue(stats.Maximum, cfg.precision())},
+					},
+				}},
+			}
+		}
+
+		metrics = append(metrics, metricdata.Metrics{
+			Name: metric.Name,
+			Unit: string(metric.unit()),
+			Data: aggregation,
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PublishSummary reports how many metrics were published and which data keys were skipped.
+type PublishSummary struct {
+	Published   int
+	Skipped     int
+	SkippedKeys []string
+
+	// Batches is how many requests the metrics were sent in, or were to be sent in when publishing failed.
+	Batches int
+
+	// Sent reports whether the metrics were sent, rather than skipped or cancelled.
+	Sent bool
+}
+
+// String will describe the summary, e.g. "Published 12 metrics, skipped 2 (foo, bar)".
+func (s PublishSummary) String() string {
+	msg := fmt.Sprintf("Published %d metrics", s.Published)
+	if s.Skipped > 0 {
+		msg += fmt.Sprintf(", skipped %d (%s)", s.Skipped, strings.Join(s.SkippedKeys, ", "))
+	}
+	return msg + "."
+}
+
+// PublishOptions controls how metrics are previewed and confirmed before publishing.
+type PublishOptions struct {
+	// Output is the preview format, one of OutputTable, OutputJSON, OutputAWSCLI or OutputMarkdown.
+	Output string
+
+	// Plain renders the table without styling.
+	Plain bool
+
+	// Redact masks every dimension value in the table preview.
+	Redact bool
+
+	// Quiet skips the table preview.
+	Quiet bool
+
+	// Strict fails when data keys have no metric mapping or a NaN or infinite value,
+	// rather than skipping them.
+	Strict bool
+
+	// NonInteractive publishes without asking for confirmation.
+	NonInteractive bool
+
+	// Verbose logs the resolved config before previewing it.
+	Verbose bool
+
+	// Out receives the preview, defaulting to stdout.
+	Out io.Writer
+
+	// In is read for the answer to the confirmation prompt, defaulting to stdin.
+	In io.Reader
+}
+
+// out will return where the preview is written.
+func (o PublishOptions) out() io.Writer {
+	if o.Out == nil {
+		return os.Stdout
+	}
+	return o.Out
+}
+
+// in will return where the answer to the confirmation prompt is read from.
+func (o PublishOptions) in() io.Reader {
+	if o.In == nil {
+		return os.Stdin
+	}
+	return o.In
+}
+
+// PublishMetrics will preview the metrics and, once confirmed, send them with the publisher.
+func PublishMetrics(publisher Publisher, data PerformanceData, previous PerformanceData, config Config, opts PublishOptions) (PublishSummary, error) {
+	var summary PublishSummary
+	if opts.Verbose {
+		logConfig(config)
+	}
+
+	// A single NaN or infinite value fails its whole batch, so those metrics are left out.
+	nonFinite := nonFiniteKeys(data, config)
+	if len(nonFinite) > 0 {
+		if opts.Strict {
+			return summary, ValidationError(fmt.Errorf("data keys have NaN or infinite values: %s", strings.Join(nonFinite, ", ")))
+		}
+		LogWarn(fmt.Sprintf("The following data keys have NaN or infinite values and will be skipped: %s", strings.Join(nonFinite, ", ")), "keys", nonFinite, "skipped", len(nonFinite))
+		data = withoutKeys(data, nonFinite)
+	}
+
+	// Suppressed and disabled metrics are marked in the table, but left out of the payload.
+	suppressed := suppressedKeys(data, config)
+	disabled := disabledKeys(data, config)
+	unsuppressed := withoutKeys(data, slices.Concat(suppressed, disabled))
+
+	var err error
+	switch opts.Output {
+	case OutputJSON:
+		printer, ok := publisher.(payloadPrinter)
+		if !ok {
+			return summary, ConfigError(fmt.Errorf("JSON output is not supported when publishing to %s", publisher.Describe()))
+		}
+		err = printer.printPayload(opts.out(), unsuppressed, config)
+	case OutputAWSCLI:
+		printer, ok := publisher.(commandPrinter)
+		if !ok {
+			return summary, ConfigError(fmt.Errorf("AWS CLI output is not supported when publishing to %s", publisher.Describe()))
+		}
+		// The commands are for running by hand, so nothing is published.
+		return summary, printer.printCommands(opts.out(), unsuppressed, config)
+	case OutputMarkdown:
+		err = PrintTable(opts.out(), data, previous, config, TableOptions{Markdown: true, Redact: opts.Redact})
+	default:
+		if !opts.Quiet {
+			err = PrintTable(opts.out(), data, previous, config, TableOptions{Plain: opts.Plain, Redact: opts.Redact})
+		}
+	}
+	if err != nil {
+		return summary, err
+	}
+
+	if len(suppressed) > 0 {
+		LogInfo(fmt.Sprintf("The following data keys are outside of their publishIfAbove or publishIfBelow condition and will be skipped: %s", strings.Join(suppressed, ", ")), "keys", suppressed, "skipped", len(suppressed))
+	}
+	if len(disabled) > 0 {
+		LogInfo(fmt.Sprintf("The following data keys have their metric disabled and will be skipped: %s", strings.Join(disabled, ", ")), "keys", disabled, "skipped", len(disabled))
+	}
+	data = unsuppressed
+
+	unmapped := UnmappedKeys(data, config)
+	summary.SkippedKeys = slices.Sorted(slices.Values(slices.Concat(nonFinite, suppressed, disabled, unmapped)))
+	summary.Skipped = len(summary.SkippedKeys)
+	if len(unmapped) > 0 {
+		if opts.Strict {
+			return summary, ValidationError(fmt.Errorf("data keys have no metric mapping: %s", strings.Join(unmapped, ", ")))
+		}
+		LogWarn(fmt.Sprintf("The following data keys have no metric mapping and will be skipped: %s", strings.Join(unmapped, ", ")), "keys", unmapped, "skipped", len(unmapped))
+	}
+
+	// Do not publish until we're ready.
+	if config.SkipPublish {
+		LogInfo("You have elected to not publish these metrics, exiting...")
+		return summary, nil
+	}
+
+	prompt := publishPrompt(publisher, data, config, len(data)-len(unmapped))
+	if opts.NonInteractive || confirm(opts.in(), prompt, config.ConfirmDefault) {
+		summary.Batches = 1
+		if counter, ok := publisher.(batchCounter); ok {
+			summary.Batches = counter.batches(data, config)
+		}
+		err = publisher.Publish(data, config)
+		if err != nil {
+			// Batches which were published before the failure are still counted.
+			summary.Published = publishedCount(err)
+			return summary, PublishError(err)
+		}
+		summary.Published = len(data) - len(unmapped)
+		summary.Sent = true
+		LogInfo(summary.String(), "published", summary.Published, "skipped", summary.Skipped, "skippedKeys", summary.SkippedKeys)
+	} else {
+		LogInfo("Operation cancelled.")
+	}
+
+	return summary, nil
+}
+
+// publishPrompt will describe what is about to be published and where, so the target can be
+// checked without scrolling back through the table, e.g. "About to publish 14 metrics to My/NS
+// via CloudWatch in account 1234 (arn) in us-east-1. Proceed?".
+func publishPrompt(publisher Publisher, data PerformanceData, config Config, count int) string {
+	noun := "metrics"
+	if count == 1 {
+		noun = "metric"
+	}
+
+	var namespaces []string
+	for _, key := range data.keys() {
+		metric, ok := config.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		if namespace := metric.namespace(config.MetricNamespace); !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	target := ""
+	switch len(namespaces) {
+	case 0:
+	case 1:
+		target = " to " + namespaces[0]
+	default:
+		sort.Strings(namespaces)
+		target = fmt.Sprintf(" to %d namespaces (%s)", len(namespaces), strings.Join(namespaces, ", "))
+	}
+
+	return fmt.Sprintf("About to publish %d %s%s via %s. Proceed?", count, noun, target, publisher.Describe())
+}
+
+// confirm will accept input for a prompt, treating an empty answer as the default. The prompt is
+// written with the status messages, so it stays off stdout when the payload is printed there.
+func confirm(in io.Reader, prompt string, defaultYes bool) bool {
+	reader := bufio.NewReader(in)
+	options := "[y/N]"
+	if defaultYes {
+		options = "[Y/n]"
+	}
+
+	for {
+		fmt.Fprintf(statusWriter(), "%s %s: ", prompt, options)
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Fprintln(statusWriter(), "Error reading input:", err)
+			return false
+		}
+
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		switch response {
+		case "":
+			return defaultYes
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		default:
+			fmt.Fprintln(statusWriter(), "Invalid input. Please enter 'y' or 'n'.")
+		}
+	}
+}
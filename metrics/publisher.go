@@ -0,0 +1,45 @@
+package metrics
+
+import "io"
+
+// Publisher sends metrics to a backend.
+type Publisher interface {
+	// Publish will send the data to the backend using the metric mappings in the config.
+	Publish(data PerformanceData, cfg Config) error
+
+	// Describe will return where the metrics are sent, for use in the confirm prompt.
+	Describe() string
+}
+
+// payloadPrinter is implemented by publishers which can print the exact payload they will send.
+type payloadPrinter interface {
+	printPayload(w io.Writer, data PerformanceData, cfg Config) error
+}
+
+// batchCounter is implemented by publishers which split the data across several requests.
+// Publishers without it send the data in a single request.
+type batchCounter interface {
+	batches(data PerformanceData, cfg Config) int
+}
+
+// closer is implemented by publishers holding a connection, which must be shut down once they
+// are done publishing.
+type closer interface {
+	close() error
+}
+
+// ClosePublisher will shut down the connection of the publisher, flushing anything it buffers,
+// when it holds one. It is called once the publisher is no longer needed, as it can publish
+// several times before then.
+func ClosePublisher(publisher Publisher) error {
+	if c, ok := publisher.(closer); ok {
+		return c.close()
+	}
+	return nil
+}
+
+// commandPrinter is implemented by publishers which can print equivalent commands
+// to send the payload with another tool.
+type commandPrinter interface {
+	printCommands(w io.Writer, data PerformanceData, cfg Config) error
+}
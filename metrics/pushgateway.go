@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pushgatewayPublisher publishes metrics to a Prometheus Pushgateway.
+type pushgatewayPublisher struct {
+	ctx    context.Context
+	url    string
+	client *http.Client
+}
+
+// NewPushgatewayPublisher will create a publisher pushing to the job's group on the Pushgateway.
+// The context aborts a push in flight when it is cancelled.
+func NewPushgatewayPublisher(ctx context.Context, baseURL string, job string, timeout time.Duration) (Publisher, error) {
+	if baseURL == "" {
+		return nil, ConfigError(fmt.Errorf("--pushgateway-url is required for the pushgateway backend"))
+	}
+	if _, err := url.ParseRequestURI(baseURL); err != nil {
+		return nil, ConfigError(fmt.Errorf("invalid Pushgateway URL %q: %w", baseURL, err))
+	}
+
+	return &pushgatewayPublisher{
+		ctx:    ctx,
+		url:    strings.TrimSuffix(baseURL, "/") + "/metrics/job/" + url.PathEscape(job),
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Describe will return the Pushgateway group the metrics are pushed to.
+func (p *pushgatewayPublisher) Describe() string {
+	return fmt.Sprintf("the Pushgateway at %s", p.url)
+}
+
+// Publish will push the metrics as gauges, replacing any previous values of the same metrics in the group.
+func (p *pushgatewayPublisher) Publish(data PerformanceData, cfg Config) error {
+	body, count := prometheusExposition(data, cfg)
+
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return abortedError(p.ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	LogInfo(fmt.Sprintf("Pushed %d metrics to %s.", count, p.url), "published", count)
+	return nil
+}
+
+// prometheusExposition will render the mapped metrics in the Prometheus text format,
+// returning the body along with the number of samples it contains.
+func prometheusExposition(data PerformanceData, cfg Config) (string, int) {
+	families := make(map[string][]string)
+	for _, key := range data.keys() {
+		metric, ok := cfg.MetricMappings[key]
+		if !ok {
+			continue
+		}
+		value := data[key]
+		name := prometheusName(metric.Name)
+		labels := prometheusLabels(cfg.dimensions(metric))
+
+		if value.Statistics == nil {
+			families[name] = append(families[name], labels+" "+prometheusValue(roundValue(value.Value, cfg.precision())))
+			continue
+		}
+		// Pre-aggregated values are split into a gauge for each statistic.
+		families[name+"_count"] = append(families[name+"_count"], labels+" "+prometheusValue(value.Statistics.SampleCount))
+		families[name+"_sum"] = append(families[name+"_sum"], labels+" "+prometheusValue(roundValue(value.Statistics.Sum, cfg.precision())))
+		families[name+"_min"] = append(families[name+"_min"], labels+" "+prometheusValue(roundValue(value.Statistics.Minimum, cfg.precision())))
+		families[name+"_max"] = append(families[name+"_max"], labels+" "+prometheusValue(roundValue(value.Statistics.Maximum, cfg.precision())))
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body strings.Builder
+	var count int
+	for _, name := range names {
+		fmt.Fprintf(&body, "# TYPE %s gauge\n", name)
+		for _, sample := range families[name] {
+			fmt.Fprintf(&body, "%s%s\n", name, sample)
+			count++
+		}
+	}
+	return body.String(), count
+}
+
+// labelValueEscaper escapes label values as required by the Prometheus text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabels will render the dimensions as a Prometheus label set.
+func prometheusLabels(dimensions []MetricMappingDimensions) string {
+	if len(dimensions) == 0 {
+		return ""
+	}
+	labels := make([]string, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, prometheusLabelName(dimension.Name), labelValueEscaper.Replace(dimension.Value)))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// prometheusName will replace characters which are not valid in a Prometheus metric name.
+func prometheusName(name string) string {
+	return sanitisePrometheus(name, func(r rune) bool { return r == '_' || r == ':' })
+}
+
+// prometheusLabelName will replace characters which are not valid in a Prometheus label name.
+func prometheusLabelName(name string) string {
+	return sanitisePrometheus(name, func(r rune) bool { return r == '_' })
+}
+
+// sanitisePrometheus will replace any character which is not alphanumeric or allowed
+// with an underscore, prefixing names which start with a digit.
+func sanitisePrometheus(name string, allowed func(rune) bool) string {
+	sanitised := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || allowed(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if sanitised == "" || (sanitised[0] >= '0' && sanitised[0] <= '9') {
+		sanitised = "_" + sanitised
+	}
+	return sanitised
+}
+
+// prometheusValue will format the value for the Prometheus text format.
+func prometheusValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mappingStub is the template written for a data key without a metric mapping.
+type mappingStub struct {
+	Name       string                    `yaml:"name"`
+	Dimensions []MetricMappingDimensions `yaml:"dimensions"`
+}
+
+// ScaffoldMappings will generate metric mapping stubs for the data keys which have
+// no mapping in the configuration document. It returns the stubs on their own, the
+// document with the stubs merged in, and the number of stubs, which is zero when
+// every data key already has a mapping. An empty document starts a new config.
+func ScaffoldMappings(data PerformanceData, document []byte) ([]byte, []byte, int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(document, &doc); err != nil {
+		return nil, nil, 0, ConfigError(err)
+	}
+
+	root, err := documentMapping(&doc)
+	if err != nil {
+		return nil, nil, 0, ConfigError(err)
+	}
+	mappings := mappingValue(root, "metricMappings")
+
+	stubs := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range data.keys() {
+		if mappingValue(mappings, key) != nil {
+			continue
+		}
+		var stub yaml.Node
+		if err := stub.Encode(mappingStub{Name: key, Dimensions: []MetricMappingDimensions{}}); err != nil {
+			return nil, nil, 0, err
+		}
+		stubs.Content = append(stubs.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &stub)
+	}
+
+	added := len(stubs.Content) / 2
+	if added == 0 {
+		return nil, nil, 0, nil
+	}
+
+	var stubsOut bytes.Buffer
+	err = encodeYAML(&stubsOut, &yaml.Node{
+		Kind:    yaml.MappingNode,
+		Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "metricMappings"}, stubs},
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	switch {
+	case mappings == nil:
+		mappings = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "metricMappings"}, mappings)
+	case mappings.Kind != yaml.MappingNode:
+		// An empty metricMappings key is parsed as a null scalar.
+		*mappings = yaml.Node{Kind: yaml.MappingNode}
+	}
+	mappings.Content = append(mappings.Content, stubs.Content...)
+
+	var merged bytes.Buffer
+	if err := encodeYAML(&merged, &doc); err != nil {
+		return nil, nil, 0, err
+	}
+	return stubsOut.Bytes(), merged.Bytes(), added, nil
+}
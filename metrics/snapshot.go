@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// snapshotHeader starts the comment at the top of a snapshot, which tells it apart from a data file.
+const snapshotHeader = "# Snapshot of the published data"
+
+// SaveSnapshot will write the data as a YAML data file headed by the time it was taken, so a
+// later run can compare against it. The data is written as published, after scaling.
+func SaveSnapshot(path string, data PerformanceData, taken time.Time) error {
+	header := fmt.Sprintf("%s, taken at %s.", snapshotHeader, taken.Format(time.RFC3339))
+	if err := writeDataFile(path, data, header); err != nil {
+		return fmt.Errorf("unable to save snapshot: %w", err)
+	}
+	LogInfo(fmt.Sprintf("Saved a snapshot of %d metrics to %s.", len(data), path), "file", path, "metrics", len(data))
+	return nil
+}
+
+// SaveRetryFile will write the data of the keys which failed to publish as a data file, so a
+// later run given it with --data publishes only those. The values are written as loaded, with the
+// timestamp they were sent with in the prepared data, or the time of the failed publish when they
+// had none. A failed derived metric is written as the data keys it is computed from, unless one of
+// them was published, in which case retrying it would publish that key again and it is skipped.
+func SaveRetryFile(path string, loaded, prepared PerformanceData, keys []string, config Config, published time.Time) error {
+	retry := PerformanceData{}
+	for _, key := range keys {
+		timestamp := prepared[key].timestamp(published)
+		sources := []string{key}
+		if source, ok := config.DerivedMetrics[key]; ok {
+			expression, err := parseDerivedExpression(source)
+			if err != nil {
+				return err
+			}
+			sources = expression.keys
+			if sent := slices.IndexFunc(sources, func(source string) bool {
+				_, mapped := config.MetricMappings[source]
+				_, ok := prepared[source]
+				return mapped && ok && !slices.Contains(keys, source)
+			}); sent >= 0 {
+				LogWarn(fmt.Sprintf("Derived metric %q failed to publish but is not retried, as %q which it is computed from was published.", key, sources[sent]), "key", key)
+				continue
+			}
+		}
+		for _, source := range sources {
+			value, ok := loaded[source]
+			if !ok {
+				continue
+			}
+			if value.Timestamp == nil {
+				value.Timestamp = &timestamp
+			}
+			retry[source] = value
+		}
+	}
+
+	header := fmt.Sprintf("# Metrics which failed to publish at %s, retry them with --data %s.", published.Format(time.RFC3339), path)
+	if err := writeDataFile(path, retry, header); err != nil {
+		return fmt.Errorf("unable to save retry file: %w", err)
+	}
+	LogWarn(fmt.Sprintf("Saved %d metrics which failed to publish to %s, retry them with --data %s.", len(retry), path, path), "file", path, "metrics", len(retry))
+	return nil
+}
+
+// writeDataFile will write the data as a YAML data file, headed by the comment.
+func writeDataFile(path string, data PerformanceData, header string) error {
+	var node yaml.Node
+	if err := node.Encode(data); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	fmt.Fprintln(&out, header)
+	if err := encodeYAML(&out, &node); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), 0o644)
+}
+
+// IsSnapshot will report whether the file at the path was written by SaveSnapshot, in which
+// case its values are already scaled.
+func IsSnapshot(path string) bool {
+	file, err := os.ReadFile(path)
+	return err == nil && bytes.HasPrefix(file, []byte(snapshotHeader))
+}
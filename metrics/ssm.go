@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// LoadConfigFromSSM will load the configuration from the SSM parameter with the given name,
+// using the region and credentials of the given config, such as those from the flags.
+// When an environment is given, the <name>.<env> parameter is merged over it.
+func LoadConfigFromSSM(ctx context.Context, name string, credentials Config, opts ConfigOptions, timeout time.Duration) (Config, error) {
+	if name == "" {
+		return Config{}, ConfigError(fmt.Errorf("--ssm-path is required for the ssm config source"))
+	}
+
+	awsConfig, err := loadAWSConfig(ctx, credentials, timeout)
+	if err != nil {
+		return Config{}, err
+	}
+	client := ssm.NewFromConfig(awsConfig)
+
+	file, err := getParameter(ctx, client, name, timeout)
+	if err != nil {
+		return Config{}, ConfigError(err)
+	}
+	if opts.Env != "" {
+		overlayName := name + "." + opts.Env
+		overlay, err := getParameter(ctx, client, overlayName, timeout)
+		switch {
+		case errors.Is(err, errParameterNotFound) && definesEnvironment(file, opts.Env):
+		case err != nil:
+			return Config{}, ConfigError(fmt.Errorf("config overlay for environment %q: %w", opts.Env, err))
+		default:
+			file, err = mergeOverlay(file, overlay, overlayName)
+			if err != nil {
+				return Config{}, ConfigError(err)
+			}
+		}
+	}
+	return parseConfig(file, opts)
+}
+
+// errParameterNotFound is returned when the SSM parameter does not exist.
+var errParameterNotFound = errors.New("config parameter not found")
+
+// getParameter will fetch the value of the SSM parameter, decrypting it when it is a SecureString.
+func getParameter(ctx context.Context, client *ssm.Client, name string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	var notFound *ssmtypes.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("%w: %s", errParameterNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch config parameter %s: %w", name, deadlineError(err, timeout))
+	}
+	return []byte(aws.ToString(output.Parameter.Value)), nil
+}
@@ -0,0 +1,285 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pterm/pterm"
+)
+
+// redactedValue is shown in place of the value of a sensitive or redacted dimension.
+const redactedValue = "***"
+
+// dryRunBanner is shown above the table when publishing is skipped.
+const dryRunBanner = "DRY RUN - nothing will be published"
+
+// maxDescriptionWidth is how many characters of a metric description are shown in the table.
+const maxDescriptionWidth = 40
+
+// TableOptions controls how the preview table is rendered.
+type TableOptions struct {
+	// Plain renders an ASCII table without styling.
+	Plain bool
+
+	// Redact masks the value of every dimension, rather than only the sensitive ones.
+	Redact bool
+
+	// Markdown renders a GitHub-flavoured Markdown table without styling, for pasting into reviews.
+	Markdown bool
+}
+
+// PrintTable will print a table showing all the metrics which are going to be pushed.
+// When previous data is given, the previous value and the change from it are shown for each metric,
+// and a description column is shown when any of the metrics has one.
+// The values of sensitive dimensions, or all of them when redacting, are masked. A banner is
+// shown above the table when publishing is skipped, so a dry run is not mistaken for a publish.
+func PrintTable(w io.Writer, data PerformanceData, previous PerformanceData, config Config, opts TableOptions) error {
+	plain := opts.Plain || opts.Markdown
+	alternateStyle := pterm.NewStyle(pterm.BgDarkGray)
+	header := []string{"Metric name", "Value", "Resolution", "Dimensions"}
+	described := slices.ContainsFunc(data.keys(), func(key string) bool {
+		return config.MetricMappings[key].Description != ""
+	})
+	if described {
+		header = append(header, "Description")
+	}
+	if previous != nil {
+		header = append(header, "Previous", "Change")
+	}
+	tableData := pterm.TableData{header}
+
+	for _, key := range data.keys() {
+		val := data[key]
+		metric := config.MetricMappings[key]
+		var dimensions string
+		for _, v := range config.dimensions(metric) {
+			if v.Sensitive || opts.Redact {
+				v.Value = redactedValue
+			}
+			dimensions += fmt.Sprintf("%s=%s ", v.Name, v.Value)
+		}
+		resolution := fmt.Sprintf("%ds", config.storageResolution(metric))
+		value := val.display(config.precision())
+		if metric.Type == metricTypePercent {
+			value += "%"
+		}
+		value = displaySeverity(value, metric.severity(val), plain)
+		name := metric.Name
+		if metric.passthrough {
+			name = displayPassthrough(name, plain)
+		}
+		if metric.suppressed(val) {
+			name = displaySuppressed(name, plain)
+		}
+		if !metric.enabled() {
+			name = displayDisabled(name, plain)
+		}
+		row := []string{name, value, resolution, dimensions}
+		if described {
+			row = append(row, truncateDescription(metric.Description))
+		}
+		if previous != nil {
+			row = append(row, displayPrevious(previous, key, config.precision()), displayChange(val, previous, key, config.precision(), plain))
+		}
+		tableData = append(tableData, row)
+	}
+
+	switch {
+	case config.SkipPublish && opts.Markdown:
+		fmt.Fprintf(w, "**%s**\n\n", dryRunBanner)
+	case config.SkipPublish:
+		fmt.Fprintln(w, displayDryRun(plain))
+	}
+	heading := "Metrics to be published"
+	if config.MetricNamespace != "" {
+		heading += " to " + config.MetricNamespace
+	}
+	if config.unitOverride != "" {
+		heading += ", all as " + config.unitOverride
+	}
+	fmt.Fprintln(w, heading+":")
+	var err error
+	switch {
+	case opts.Markdown:
+		// A table directly under a paragraph is not recognised, so it is set apart by a blank line.
+		fmt.Fprintln(w)
+		err = printMarkdownTable(w, tableData)
+	case plain:
+		err = printPlainTable(w, tableData)
+	default:
+		err = pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData).WithStyle(alternateStyle).WithWriter(w).Render()
+	}
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for _, key := range previous.keys() {
+		if _, ok := data[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) > 0 {
+		LogWarn(fmt.Sprintf("The following metrics were in the comparison data but are missing now: %s", strings.Join(removed, ", ")), "keys", removed)
+	}
+	return nil
+}
+
+// printPlainTable will render the table as plain ASCII, for output which is not a terminal. The
+// columns are as wide as their widest cell in characters, so non-ASCII values stay aligned.
+func printPlainTable(w io.Writer, tableData pterm.TableData) error {
+	widths := make([]int, len(tableData[0]))
+	for _, row := range tableData {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var separator strings.Builder
+	separator.WriteString("+")
+	for _, width := range widths {
+		separator.WriteString(strings.Repeat("-", width+2) + "+")
+	}
+
+	lines := []string{separator.String()}
+	for i, row := range tableData {
+		var line strings.Builder
+		line.WriteString("|")
+		for j, cell := range row {
+			line.WriteString(fmt.Sprintf(" %-*s |", widths[j], cell))
+		}
+		lines = append(lines, line.String())
+		if i == 0 {
+			lines = append(lines, separator.String())
+		}
+	}
+	lines = append(lines, separator.String())
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// markdownCellEscaper escapes the characters which would end a Markdown table cell early.
+var markdownCellEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+// printMarkdownTable will render the table as a GitHub-flavoured Markdown table.
+func printMarkdownTable(w io.Writer, tableData pterm.TableData) error {
+	var out strings.Builder
+	for i, row := range tableData {
+		cells := make([]string, 0, len(row))
+		for _, cell := range row {
+			cells = append(cells, markdownCellEscaper.Replace(strings.TrimSpace(cell)))
+		}
+		fmt.Fprintf(&out, "| %s |\n", strings.Join(cells, " | "))
+		if i == 0 {
+			fmt.Fprintf(&out, "|%s\n", strings.Repeat(" --- |", len(row)))
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// displaySeverity will highlight a value which crossed a threshold, yellow for warn and
+// red for critical, or with the severity in brackets when plain.
+func displaySeverity(value, severity string, plain bool) string {
+	switch {
+	case severity == "":
+		return value
+	case plain:
+		return fmt.Sprintf("%s (%s)", value, severity)
+	case severity == severityCritical:
+		return pterm.FgRed.Sprint(value)
+	}
+	return pterm.FgYellow.Sprint(value)
+}
+
+// displayDryRun will return the dry run banner, highlighted in yellow unless plain.
+func displayDryRun(plain bool) string {
+	if plain {
+		return dryRunBanner
+	}
+	return pterm.NewStyle(pterm.BgYellow, pterm.FgBlack, pterm.Bold).Sprintf(" %s ", dryRunBanner)
+}
+
+// displayPassthrough will mark the name of a metric whose mapping was generated for its data
+// key, in cyan unless plain.
+func displayPassthrough(name string, plain bool) string {
+	name += " (auto)"
+	if plain {
+		return name
+	}
+	return pterm.FgCyan.Sprint(name)
+}
+
+// displaySuppressed will mark the name of a metric which will not be published because it
+// fails its publish condition, greyed out unless plain.
+func displaySuppressed(name string, plain bool) string {
+	name += " (suppressed)"
+	if plain {
+		return name
+	}
+	return pterm.FgGray.Sprint(name)
+}
+
+// displayDisabled will mark the name of a metric which will not be published because it is
+// disabled, greyed out unless plain.
+func displayDisabled(name string, plain bool) string {
+	name += " (disabled)"
+	if plain {
+		return name
+	}
+	return pterm.FgGray.Sprint(name)
+}
+
+// truncateDescription will shorten the description to fit the table, on a single line.
+func truncateDescription(description string) string {
+	description = strings.Join(strings.Fields(description), " ")
+	if utf8.RuneCountInString(description) <= maxDescriptionWidth {
+		return description
+	}
+	// The marker is ASCII, so it lines up in the plain table too.
+	return string([]rune(description)[:maxDescriptionWidth-3]) + "..."
+}
+
+// displayPrevious will format the previous value of the metric, or a dash when there is none.
+func displayPrevious(previous PerformanceData, key string, precision int) string {
+	old, ok := previous[key]
+	if !ok {
+		return "-"
+	}
+	return old.display(precision)
+}
+
+// displayChange will format the change in the value since the previous data,
+// coloured green for an increase and red for a decrease unless plain.
+func displayChange(value MetricValue, previous PerformanceData, key string, precision int, plain bool) string {
+	old, ok := previous[key]
+	switch {
+	case !ok && plain:
+		return "new"
+	case !ok:
+		return pterm.FgYellow.Sprint("new")
+	case value.Statistics != nil || old.Statistics != nil:
+		return "-"
+	}
+
+	delta := roundValue(value.Value-old.Value, precision)
+	change := fmt.Sprintf("%+g", delta)
+	if old.Value != 0 {
+		change += fmt.Sprintf(" (%+.1f%%)", delta/math.Abs(old.Value)*100)
+	}
+
+	switch {
+	case plain:
+		return change
+	case delta > 0:
+		return pterm.FgGreen.Sprint(change)
+	case delta < 0:
+		return pterm.FgRed.Sprint(change)
+	}
+	return change
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// unitSuffixes maps metric name suffixes to the unit inferred for them by InferUnits.
+// The first matching suffix wins, so longer suffixes should come before shorter ones.
+var unitSuffixes = []struct {
+	suffix string
+	unit   types.StandardUnit
+}{
+	{"_ms", types.StandardUnitMilliseconds},
+	{"_bytes", types.StandardUnitBytes},
+	{"_percent", types.StandardUnitPercent},
+	{"_count", types.StandardUnitCount},
+}
+
+// InferUnits will set the unit of each metric mapping without one from the suffix of
+// its name, such as Milliseconds for a name ending in _ms. Explicit units are kept, and
+// the units of passthrough mappings added later are also inferred.
+func InferUnits(cfg *Config) {
+	cfg.inferUnits = true
+	for key, metric := range cfg.MetricMappings {
+		if metric.Unit != "" {
+			continue
+		}
+		if unit, ok := inferUnit(metric.Name); ok {
+			metric.Unit = string(unit)
+			cfg.MetricMappings[key] = metric
+		}
+	}
+}
+
+// OverrideUnits will set the unit of every metric mapping, ignoring the units in the config.
+// The unit must be a CloudWatch standard unit, and is also used for passthrough mappings.
+func OverrideUnits(cfg *Config, unit string) error {
+	if !slices.Contains(types.StandardUnit("").Values(), types.StandardUnit(unit)) {
+		return fmt.Errorf("unknown unit %q", unit)
+	}
+	mappings := make(map[string]MetricMapping, len(cfg.MetricMappings))
+	for key, metric := range cfg.MetricMappings {
+		metric.Unit = unit
+		mappings[key] = metric
+	}
+	cfg.MetricMappings = mappings
+	cfg.unitOverride = unit
+	return nil
+}
+
+// inferUnit will return the unit for the metric name's suffix, if it has a known one.
+func inferUnit(name string) (types.StandardUnit, bool) {
+	for _, s := range unitSuffixes {
+		if strings.HasSuffix(name, s.suffix) {
+			return s.unit, true
+		}
+	}
+	return "", false
+}
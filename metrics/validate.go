@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"fmt"
+)
+
+// FindProblems will return a description of each inconsistency between the data and the configuration.
+func FindProblems(data PerformanceData, config Config) []string {
+	var problems []string
+
+	for key := range data {
+		metric, ok := config.MetricMappings[key]
+		if ok && metric.namespace(config.MetricNamespace) == "" {
+			problems = append(problems, "metric namespace is not set")
+			break
+		}
+	}
+
+	if config.Region == "" {
+		problems = append(problems, "region is not set in the config or AWS_REGION")
+	}
+
+	for _, key := range UnmappedKeys(data, config) {
+		problems = append(problems, fmt.Sprintf("data key %q has no metric mapping", key))
+	}
+
+	for _, err := range CheckMetrics(ScaleData(data, config), config) {
+		problems = append(problems, err.Error())
+	}
+
+	return problems
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// documentMapping will return the top-level mapping of the document, creating it when the document is empty.
+func documentMapping(document *yaml.Node) (*yaml.Node, error) {
+	if document.Kind == 0 {
+		document.Kind = yaml.DocumentNode
+	}
+	if len(document.Content) == 0 {
+		document.Content = append(document.Content, &yaml.Node{Kind: yaml.MappingNode})
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("configuration file must contain a mapping at the top level")
+	}
+	return root, nil
+}
+
+// mappingValue will return the value node for the key in the mapping, or nil when it is absent.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// encodeYAML will write the node as YAML with the indentation used in the README examples.
+func encodeYAML(w io.Writer, node *yaml.Node) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"personal-performance-metrics/metrics"
+)
+
+// scaffold will generate metric mapping stubs for the data keys which have no
+// mapping, either printing them or merging them into the configuration file.
+func scaffold() error {
+	dataInput, err := loadData()
+	if err != nil {
+		return err
+	}
+
+	var configFile string
+	var file []byte
+	switch {
+	case *cliFile != "" && *scaffoldWrite:
+		return metrics.ConfigError(fmt.Errorf("scaffold --write cannot merge into the combined file given with --file"))
+	case *cliFile != "":
+		file, err = metrics.CombinedSection(*cliFile, metrics.CombinedConfigSection)
+		if err != nil {
+			return err
+		}
+	case len(*cliConfigFiles) > 1:
+		return metrics.ConfigError(fmt.Errorf("scaffold works on a single config file, but %d were given with --config", len(*cliConfigFiles)))
+	default:
+		configFile = (*cliConfigFiles)[0]
+		file, err = os.ReadFile(configFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// A missing file is fine, as a new config file can be created.
+			return metrics.ConfigError(err)
+		}
+	}
+
+	stubs, merged, added, err := metrics.ScaffoldMappings(dataInput, file)
+	if err != nil {
+		return err
+	}
+
+	if added == 0 {
+		metrics.LogInfo("All data keys already have a metric mapping.")
+		return nil
+	}
+
+	if !*scaffoldWrite {
+		_, err = os.Stdout.Write(stubs)
+		return err
+	}
+
+	if err := os.WriteFile(configFile, merged, 0o644); err != nil {
+		return err
+	}
+	metrics.LogInfo(fmt.Sprintf("Added %d metric mappings to %s.", added, configFile), "added", added)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"personal-performance-metrics/metrics"
+)
+
+// runSummary is the final line printed by --summary json, for automation to parse.
+type runSummary struct {
+	Published  int    `json:"published"`
+	Skipped    int    `json:"skipped"`
+	Batches    int    `json:"batches"`
+	DurationMs int64  `json:"durationMs"`
+	Namespace  string `json:"namespace"`
+	Region     string `json:"region"`
+	Error      string `json:"error,omitempty"`
+}
+
+// printSummary will print the outcome of the run as a single JSON object when --summary json
+// is set, regardless of --quiet, including the error when the run failed.
+func printSummary(cfg metrics.Config, summary metrics.PublishSummary, duration time.Duration, err error) {
+	if *cliSummary != summaryFormatJSON {
+		return
+	}
+	line := runSummary{
+		Published:  summary.Published,
+		Skipped:    summary.Skipped,
+		Batches:    summary.Batches,
+		DurationMs: duration.Milliseconds(),
+		Namespace:  cfg.MetricNamespace,
+		Region:     cfg.Region,
+	}
+	if err != nil {
+		line.Error = err.Error()
+	}
+	encoded, marshalErr := json.Marshal(line)
+	if marshalErr != nil {
+		metrics.LogError(fmt.Sprintf("Unable to print the summary: %v", marshalErr), "error", marshalErr)
+		return
+	}
+	fmt.Println(string(encoded))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"personal-performance-metrics/metrics"
+)
+
+// validate will check the configuration and data files are consistent without publishing. No AWS
+// calls are made unless the configuration is loaded from SSM.
+func validate() error {
+	configInput, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	if configInput.Region == "" {
+		configInput.Region = *cliRegion
+	}
+
+	if *cliNamespace != "" {
+		if err := metrics.ValidateNamespace("--namespace", *cliNamespace); err != nil {
+			return metrics.ValidationError(err)
+		}
+		configInput.MetricNamespace = *cliNamespace
+	}
+
+	dataInput, err := loadData()
+	if err != nil {
+		return err
+	}
+
+	problems := metrics.FindProblems(dataInput, configInput)
+	if len(problems) == 0 {
+		fmt.Println("Configuration and data are valid.")
+		return nil
+	}
+
+	fmt.Println("Validation found the following problems:")
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	return metrics.ValidationError(fmt.Errorf("validation failed with %d problem(s)", len(problems)))
+}
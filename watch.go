@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"personal-performance-metrics/metrics"
+)
+
+// watchDebounce is how long to wait after a change before republishing, so the
+// several events of a single save only publish once.
+const watchDebounce = 500 * time.Millisecond
+
+// watch will publish the data files, then republish them each time one changes
+// until interrupted.
+func watch(ctx context.Context, cfg metrics.Config) error {
+	if slices.ContainsFunc(*cliDataFiles, metrics.IsStdin) {
+		return metrics.ConfigError(fmt.Errorf("--watch cannot be used when reading data from stdin"))
+	}
+	if slices.ContainsFunc(*cliDataFiles, metrics.IsURL) {
+		return metrics.ConfigError(fmt.Errorf("--watch cannot be used when fetching data from a URL"))
+	}
+	// Prompting on every change is impractical.
+	*cliNoninteractive = true
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Editors often replace the file rather than write to it, so the directories are
+	// watched and the events filtered to the data files.
+	paths := *cliDataFiles
+	if *cliFile != "" {
+		paths = []string{*cliFile}
+	}
+	var files []string
+	for _, path := range paths {
+		file, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return metrics.ConfigError(fmt.Errorf("unable to watch %s: %w", path, err))
+		}
+		files = append(files, file)
+	}
+
+	republish := func() {
+		if err := publishDataFiles(ctx, cfg); err != nil {
+			metrics.LogError(fmt.Sprintf("Publish failed: %v", err), "error", err)
+		}
+	}
+	republish()
+	metrics.LogInfo("Watching for changes, press Ctrl-C to stop.")
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			metrics.LogInfo("Stopped watching.")
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if slices.Contains(files, filepath.Clean(event.Name)) && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			metrics.LogWarn(fmt.Sprintf("Watch error: %v", err), "error", err)
+		case <-debounce.C:
+			metrics.LogInfo("Data changed, republishing.")
+			republish()
+		}
+	}
+}